@@ -3,33 +3,114 @@ package main
 import (
 	"context"
 	"errors"
+	"expvar"
+	"io"
 	"log/slog"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	"agregator/internal/cache"
+	"agregator/internal/digest"
+	"agregator/internal/history"
 	"agregator/internal/httpapi"
+	"agregator/internal/marketplace"
 	"agregator/internal/marketplace/ozon"
 	"agregator/internal/marketplace/wb"
 	"agregator/internal/search"
+	"agregator/internal/telegram"
+	"agregator/internal/watch"
+	"agregator/internal/webhook"
 )
 
-const searchTimeout = 60 * time.Second
+const (
+	searchTimeout      = 60 * time.Second
+	defaultMemorySize  = 1000
+	defaultHistoryPath = "history.db"
+	defaultWatchPath   = "watch.db"
+	defaultWatchPeriod = 30 * time.Minute
+	defaultWebhookPath = "webhook.db"
+	defaultDigestHour  = 9
+	parserAlertPeriod  = time.Hour
+)
 
+// main serves the HTTP API and the web interface. "marketagregator telegram"
+// runs the Telegram bot instead.
 func main() {
 	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelInfo}))
-	redisCache := connectRedis(logger)
-	if redisCache != nil {
-		defer redisCache.Close()
+	botMode := len(os.Args) > 1 && os.Args[1] == "telegram"
+	searchCache := newCache(logger)
+	if closer, ok := searchCache.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	registry := newRegistry(logger)
+	marketplaces, err := registry.Build(logger, marketplace.ParseNames(os.Getenv("MARKETPLACES")))
+	if err != nil {
+		logger.Error("configure marketplaces", "error", err)
+		os.Exit(1)
+	}
+	for _, m := range marketplaces {
+		logger.Info("marketplace enabled", "marketplace", m.Name())
+	}
+
+	service := search.New(logger.With("component", "search"), searchCache, marketplaces...)
+	service.SetCachePolicy(search.CachePolicy{
+		SoftTTL:    envDuration(logger, "CACHE_SOFT_TTL", search.DefaultCachePolicy.SoftTTL),
+		HardTTL:    envDuration(logger, "CACHE_HARD_TTL", search.DefaultCachePolicy.HardTTL),
+		PartialTTL: envDuration(logger, "CACHE_PARTIAL_TTL", search.DefaultCachePolicy.PartialTTL),
+		EmptyTTL:   envDuration(logger, "CACHE_EMPTY_TTL", search.DefaultCachePolicy.EmptyTTL),
+	})
+	prices := openHistory(logger)
+	if prices != nil {
+		defer prices.Close()
+		service.SetRecorder(prices)
+		service.SetPriceChecker(prices)
+	}
+	dispatcher := newDispatcher(logger)
+	var notifiers watch.Notifiers
+	if dispatcher != nil {
+		notifiers = append(notifiers, dispatcher)
+		service.SetFetchObserver(webhook.NewParserMonitor(dispatcher, parserAlertPeriod))
+	}
+	watches := openWatches(logger)
+	if watches != nil {
+		defer watches.Close()
 	}
+	labels := marketplaceLabels(registry)
+	if botMode {
+		runTelegram(logger, labels, service, watches)
+		return
+	}
+	startScheduler(context.Background(), logger, watches, service, notifiers)
+	startDigest(context.Background(), logger, labels, service, prices, watches)
 
-	service := search.New(logger.With("component", "search"), redisCache, ozon.New(logger), wb.New(logger))
 	handler := httpapi.New(logger.With("component", "http"), service, searchTimeout)
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("/search", handler.Search)
+	mux.HandleFunc("/search/stream", handler.Stream)
+	mux.Handle("/debug/vars", expvar.Handler())
+	httpapi.NewMarketplaces(enabledMarketplaces(marketplaces, labels)).Register(mux)
+	if prices != nil {
+		httpapi.NewHistory(logger.With("component", "history"), prices).Register(mux)
+	}
 	mux.Handle("/", http.FileServer(http.Dir("web/dist")))
+	if token := os.Getenv("ADMIN_TOKEN"); token == "" {
+		logger.Info("admin endpoints disabled: ADMIN_TOKEN is not set")
+	} else {
+		if cacheAdmin, ok := searchCache.(cache.Admin); ok {
+			httpapi.NewAdmin(logger.With("component", "admin"), token, cacheAdmin, service).Register(mux)
+		}
+		if watches != nil {
+			httpapi.NewWatches(logger.With("component", "watch"), token, watches).Register(mux)
+		}
+	}
 
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -38,7 +119,7 @@ func main() {
 
 	server := &http.Server{
 		Addr:              ":" + port,
-		Handler:           mux,
+		Handler:           httpapi.RequestID(mux),
 		ReadHeaderTimeout: 5 * time.Second,
 		ReadTimeout:       10 * time.Second,
 		WriteTimeout:      90 * time.Second,
@@ -51,8 +132,266 @@ func main() {
 	}
 }
 
+func newRegistry(logger *slog.Logger) *marketplace.Registry {
+	httpConfig := marketplace.HTTPConfig{Proxy: proxyURL(logger)}
+	registry := marketplace.NewRegistry()
+	registry.MustRegister(ozon.Info, func(logger *slog.Logger) search.Marketplace {
+		return ozon.New(logger,
+			ozon.WithPages(envInt(logger, "OZON_PAGES")),
+			ozon.WithHTTP(httpConfig),
+			ozon.WithCookiesFile(os.Getenv("OZON_COOKIES_FILE")),
+		)
+	})
+	registry.MustRegister(wb.Info, func(logger *slog.Logger) search.Marketplace {
+		return wb.New(logger, wb.WithPages(envInt(logger, "WB_PAGES")), wb.WithHTTP(httpConfig))
+	})
+	return registry
+}
+
+// proxyURL parses PROXY_URL. An invalid URL stops the start, because the
+// requests would otherwise silently bypass the proxy.
+func proxyURL(logger *slog.Logger) *url.URL {
+	value := strings.TrimSpace(os.Getenv("PROXY_URL"))
+	if value == "" {
+		return nil
+	}
+	proxy, err := url.Parse(value)
+	if err != nil || proxy.Host == "" {
+		logger.Error("invalid PROXY_URL")
+		os.Exit(1)
+	}
+	logger.Info("using proxy for marketplace requests", "proxy", proxy.Redacted())
+	return proxy
+}
+
+// envInt returns zero for unset or invalid values so that the adapters keep
+// their defaults.
+func envInt(logger *slog.Logger, name string) int {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return 0
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		logger.Warn("ignoring invalid environment variable", "name", name, "value", value)
+		return 0
+	}
+	return n
+}
+
+func envDuration(logger *slog.Logger, name string, fallback time.Duration) time.Duration {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		logger.Warn("ignoring invalid environment variable", "name", name, "value", value)
+		return fallback
+	}
+	return d
+}
+
+// newCache keeps hot results in memory in front of Redis. Without Redis the
+// in-memory cache is used alone.
+func newCache(logger *slog.Logger) search.Cache {
+	size := envInt(logger, "MEMORY_CACHE_SIZE")
+	if size == 0 {
+		size = defaultMemorySize
+	}
+	memory := cache.NewMemory(size)
+
+	redisCache := connectRedis(logger)
+	if redisCache == nil {
+		logger.Info("using in-memory cache", "size", size)
+		return memory
+	}
+	return cache.NewTiered(memory, redisCache, envDuration(logger, "MEMORY_CACHE_TTL", time.Minute))
+}
+
+// openHistory opens the price history database. Searches keep working without
+// it, only the prices are not recorded.
+func openHistory(logger *slog.Logger) *history.Store {
+	path := strings.TrimSpace(os.Getenv("HISTORY_DB"))
+	if path == "" {
+		path = defaultHistoryPath
+	}
+	store, err := history.Open(path)
+	if err != nil {
+		logger.Warn("price history disabled", "path", path, "error", err)
+		return nil
+	}
+	logger.Info("recording price history", "path", path)
+	return store
+}
+
+// newDispatcher starts delivering webhooks when WEBHOOK_URL and WEBHOOK_SECRET
+// are set. Undelivered events are kept in WEBHOOK_DB.
+func newDispatcher(logger *slog.Logger) *webhook.Dispatcher {
+	url := strings.TrimSpace(os.Getenv("WEBHOOK_URL"))
+	secret := os.Getenv("WEBHOOK_SECRET")
+	switch {
+	case url == "":
+		logger.Info("webhooks disabled: WEBHOOK_URL is not set")
+		return nil
+	case secret == "":
+		logger.Error("webhooks disabled: WEBHOOK_SECRET is required to sign payloads")
+		return nil
+	}
+	path := strings.TrimSpace(os.Getenv("WEBHOOK_DB"))
+	if path == "" {
+		path = defaultWebhookPath
+	}
+	deadLetters, err := webhook.OpenDeadLetters(path)
+	if err != nil {
+		logger.Error("webhooks disabled", "path", path, "error", err)
+		return nil
+	}
+	dispatcher := webhook.New(logger.With("component", "webhook"), webhook.Config{
+		URL:         url,
+		Secret:      secret,
+		MaxAttempts: envInt(logger, "WEBHOOK_MAX_ATTEMPTS"),
+	}, deadLetters)
+	go dispatcher.Run(context.Background())
+	logger.Info("webhooks enabled", "url", url, "dead_letters", path)
+	return dispatcher
+}
+
+func openWatches(logger *slog.Logger) *watch.Store {
+	path := strings.TrimSpace(os.Getenv("WATCH_DB"))
+	if path == "" {
+		path = defaultWatchPath
+	}
+	store, err := watch.Open(path)
+	if err != nil {
+		logger.Warn("watchlists disabled", "path", path, "error", err)
+		return nil
+	}
+	return store
+}
+
+// startScheduler starts the price-drop scheduler when a notifier is configured
+// and WATCH_INTERVAL is not zero.
+func startScheduler(ctx context.Context, logger *slog.Logger, store *watch.Store, service *search.Service, notifiers watch.Notifiers) {
+	interval := envDuration(logger, "WATCH_INTERVAL", defaultWatchPeriod)
+	switch {
+	case store == nil:
+	case interval == 0:
+		logger.Info("watch scheduler disabled: WATCH_INTERVAL is 0")
+	case len(notifiers) == 0:
+		logger.Info("watch scheduler disabled: no notifier is configured")
+	default:
+		scheduler := watch.NewScheduler(logger.With("component", "watch"), store, service, notifiers, interval)
+		go scheduler.Run(ctx)
+		logger.Info("watch scheduler started", "interval", interval)
+	}
+}
+
+// runTelegram serves the Telegram bot until the process is stopped. Its
+// scheduler checks only the watches of Telegram chats; the others and the email
+// digests stay with the HTTP server, so the bot can run next to it.
+func runTelegram(logger *slog.Logger, labels map[string]string, service *search.Service, watches *watch.Store) {
+	token := strings.TrimSpace(os.Getenv("TELEGRAM_BOT_TOKEN"))
+	if token == "" {
+		logger.Error("TELEGRAM_BOT_TOKEN is required to run the bot")
+		return
+	}
+	apiURL := strings.TrimSpace(os.Getenv("TELEGRAM_API_URL"))
+	if apiURL == "" {
+		apiURL = telegram.DefaultAPIURL
+	}
+	bot := telegram.NewBot(logger.With("component", "telegram"), telegram.NewClient(apiURL, token), service, watches, telegram.Options{
+		PageSize:      envInt(logger, "TELEGRAM_PAGE_SIZE"),
+		Labels:        labels,
+		SearchTimeout: searchTimeout,
+	})
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	startScheduler(ctx, logger, watches, service, watch.Notifiers{bot})
+	logger.Info("telegram bot started", "api", apiURL)
+	if err := bot.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
+		logger.Error("telegram bot stopped unexpectedly", "error", err)
+	}
+}
+
+// startDigest starts sending email digests when DIGEST_PERIOD and the SMTP
+// server are configured.
+func startDigest(ctx context.Context, logger *slog.Logger, labels map[string]string, service *search.Service, prices *history.Store, watches *watch.Store) {
+	value := os.Getenv("DIGEST_PERIOD")
+	switch {
+	case strings.TrimSpace(value) == "":
+		logger.Info("email digests disabled: DIGEST_PERIOD is not set")
+		return
+	case watches == nil:
+		return
+	}
+	period, err := digest.ParsePeriod(value)
+	if err != nil {
+		logger.Error("email digests disabled", "error", err)
+		return
+	}
+	hour := defaultDigestHour
+	if value := strings.TrimSpace(os.Getenv("DIGEST_HOUR")); value != "" {
+		h, err := strconv.Atoi(value)
+		if err != nil || h < 0 || h > 23 {
+			logger.Warn("ignoring invalid environment variable", "name", "DIGEST_HOUR", "value", value)
+		} else {
+			hour = h
+		}
+	}
+	sender, err := digest.NewSMTP(digest.SMTPConfig{
+		Host:     strings.TrimSpace(os.Getenv("SMTP_HOST")),
+		Port:     envInt(logger, "SMTP_PORT"),
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     os.Getenv("SMTP_FROM"),
+		TLS:      strings.ToLower(strings.TrimSpace(os.Getenv("SMTP_TLS"))),
+	})
+	if err != nil {
+		logger.Error("email digests disabled", "error", err)
+		return
+	}
+	// A nil store must not become a non-nil interface.
+	var priceHistory digest.PriceHistory
+	if prices != nil {
+		priceHistory = prices
+	}
+	mailer := digest.New(logger.With("component", "digest"), watches, service, priceHistory, sender, digest.Options{
+		Period: period,
+		Hour:   hour,
+		Labels: labels,
+	})
+	go mailer.Run(ctx)
+	logger.Info("email digests enabled", "period", period, "hour", hour)
+}
+
+func marketplaceLabels(registry *marketplace.Registry) map[string]string {
+	labels := make(map[string]string)
+	for _, info := range registry.List() {
+		labels[info.Name] = info.Label
+	}
+	return labels
+}
+
+func enabledMarketplaces(marketplaces []search.Marketplace, labels map[string]string) []httpapi.Marketplace {
+	list := make([]httpapi.Marketplace, 0, len(marketplaces))
+	for _, m := range marketplaces {
+		label := labels[m.Name()]
+		if label == "" {
+			label = m.Name()
+		}
+		list = append(list, httpapi.Marketplace{Name: m.Name(), Label: label})
+	}
+	return list
+}
+
 func connectRedis(logger *slog.Logger) *cache.Redis {
-	redisCache := cache.NewFromEnv()
+	redisCache, err := cache.NewFromEnv()
+	if err != nil {
+		logger.Error("configure Redis", "error", err)
+		os.Exit(1)
+	}
 	for attempt := 1; attempt <= 4; attempt++ {
 		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 		err := redisCache.Ping(ctx)
@@ -70,6 +409,6 @@ func connectRedis(logger *slog.Logger) *cache.Redis {
 	if err := redisCache.Close(); err != nil {
 		logger.Warn("close Redis client", "error", err)
 	}
-	logger.Warn("starting without cache")
+	logger.Warn("starting without Redis")
 	return nil
 }
@@ -0,0 +1,203 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Info describes a cached query.
+type Info struct {
+	Query      string `json:"query"`
+	Products   int    `json:"products"`
+	SizeBytes  int    `json:"size_bytes"`
+	AgeSeconds int64  `json:"age_seconds"`
+	TTLSeconds int64  `json:"ttl_seconds"`
+}
+
+// Admin lists and deletes cached queries. An empty prefix matches every query.
+type Admin interface {
+	List(ctx context.Context, prefix string, limit int) ([]Info, error)
+	Delete(ctx context.Context, query string) (int, error)
+	DeletePrefix(ctx context.Context, prefix string) (int, error)
+}
+
+// scan calls fn for every search key of the current schema version whose query
+// starts with prefix, on every master of a cluster. Masters are scanned in
+// parallel, but calls of fn never overlap.
+func (r *Redis) scan(ctx context.Context, prefix string, fn func(key string) error) error {
+	match := r.searchKey(escapeGlob(prefix)) + "*"
+	var mu sync.Mutex
+	scanNode := func(ctx context.Context, client redis.Cmdable) error {
+		iter := client.Scan(ctx, 0, match, 100).Iterator()
+		for iter.Next(ctx) {
+			mu.Lock()
+			err := fn(iter.Val())
+			mu.Unlock()
+			if err != nil {
+				return err
+			}
+		}
+		return iter.Err()
+	}
+	if cluster, ok := r.client.(*redis.ClusterClient); ok {
+		return cluster.ForEachMaster(ctx, func(ctx context.Context, client *redis.Client) error {
+			return scanNode(ctx, client)
+		})
+	}
+	return scanNode(ctx, r.client)
+}
+
+// List returns the first limit queries in alphabetical order, like
+// Memory.List. All matching keys are scanned and sorted first; only the
+// returned ones are read.
+func (r *Redis) List(ctx context.Context, prefix string, limit int) ([]Info, error) {
+	var keys []string
+	err := r.scan(ctx, prefix, func(key string) error {
+		keys = append(keys, key)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list cached queries: %w", err)
+	}
+	slices.Sort(keys)
+
+	keyPrefix := r.searchKey("")
+	infos := []Info{}
+	for _, key := range keys {
+		if limit > 0 && len(infos) >= limit {
+			break
+		}
+		value, err := r.client.Get(ctx, key).Bytes()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("list cached queries: %w", err)
+		}
+		ttl, err := r.client.PTTL(ctx, key).Result()
+		if err != nil {
+			return nil, fmt.Errorf("list cached queries: %w", err)
+		}
+		info := Info{Query: strings.TrimPrefix(key, keyPrefix), SizeBytes: len(value), TTLSeconds: int64(ttl.Seconds())}
+		if entry, err := decodeEntry(value); err == nil {
+			info.Products = len(entry.Products)
+			info.AgeSeconds = int64(time.Since(entry.FetchedAt).Seconds())
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+func (r *Redis) Delete(ctx context.Context, query string) (int, error) {
+	n, err := r.client.Del(ctx, r.searchKey(query)).Result()
+	return int(n), err
+}
+
+func (r *Redis) DeletePrefix(ctx context.Context, prefix string) (int, error) {
+	var deleted int
+	err := r.scan(ctx, prefix, func(key string) error {
+		n, err := r.client.Del(ctx, key).Result()
+		deleted += int(n)
+		return err
+	})
+	if err != nil {
+		return deleted, fmt.Errorf("delete cached queries: %w", err)
+	}
+	return deleted, nil
+}
+
+func escapeGlob(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(`*?[]\`, r) {
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func (m *Memory) List(_ context.Context, prefix string, limit int) ([]Info, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	infos := []Info{}
+	for query, element := range m.items {
+		item := element.Value.(*memoryItem)
+		if !strings.HasPrefix(query, prefix) || !now.Before(item.expires) {
+			continue
+		}
+		info := Info{
+			Query:      query,
+			Products:   len(item.entry.Products),
+			AgeSeconds: int64(now.Sub(item.entry.FetchedAt).Seconds()),
+			TTLSeconds: int64(item.expires.Sub(now).Seconds()),
+		}
+		if value, err := encodeEntry(item.entry); err == nil {
+			info.SizeBytes = len(value)
+		}
+		infos = append(infos, info)
+	}
+	slices.SortFunc(infos, func(a, b Info) int { return strings.Compare(a.Query, b.Query) })
+	if limit > 0 && len(infos) > limit {
+		infos = infos[:limit]
+	}
+	return infos, nil
+}
+
+func (m *Memory) Delete(_ context.Context, query string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	element, ok := m.items[query]
+	if !ok {
+		return 0, nil
+	}
+	m.remove(element)
+	return 1, nil
+}
+
+func (m *Memory) DeletePrefix(_ context.Context, prefix string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var deleted int
+	for query, element := range m.items {
+		if strings.HasPrefix(query, prefix) {
+			m.remove(element)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// List reports the shared cache when it supports administration. Deletes go
+// to both tiers; other replicas keep their in-memory copies for up to
+// memoryTTL.
+func (t *Tiered) List(ctx context.Context, prefix string, limit int) ([]Info, error) {
+	if admin, ok := t.remote.(Admin); ok {
+		return admin.List(ctx, prefix, limit)
+	}
+	return t.memory.List(ctx, prefix, limit)
+}
+
+func (t *Tiered) Delete(ctx context.Context, query string) (int, error) {
+	deleted, _ := t.memory.Delete(ctx, query)
+	if admin, ok := t.remote.(Admin); ok {
+		return admin.Delete(ctx, query)
+	}
+	return deleted, nil
+}
+
+func (t *Tiered) DeletePrefix(ctx context.Context, prefix string) (int, error) {
+	deleted, _ := t.memory.DeletePrefix(ctx, prefix)
+	if admin, ok := t.remote.(Admin); ok {
+		return admin.DeletePrefix(ctx, prefix)
+	}
+	return deleted, nil
+}
@@ -0,0 +1,89 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"agregator/internal/product"
+	"agregator/internal/search"
+)
+
+func TestRedisListAndDelete(t *testing.T) {
+	store, server := newTestRedis(t)
+	ctx := context.Background()
+	for _, query := range []string{"iphone 15", "iphone 15 pro", "tv*"} {
+		entry := search.Entry{Products: []product.Product{{Key: "wb:1"}}, FetchedAt: time.Now().Add(-time.Minute)}
+		if err := store.Set(ctx, query, entry, time.Hour); err != nil {
+			t.Fatalf("Set() error = %v", err)
+		}
+	}
+	server.Set("other-app:key", "value")
+
+	infos, err := store.List(ctx, "", 0)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(infos) != 3 || infos[0].Query != "iphone 15" || infos[2].Query != "tv*" {
+		t.Fatalf("List() = %#v", infos)
+	}
+	if info := infos[0]; info.Products != 1 || info.SizeBytes == 0 || info.AgeSeconds < 59 || info.TTLSeconds != 3600 {
+		t.Fatalf("List() info = %#v", info)
+	}
+	// The limit keeps the first queries in alphabetical order, not the first
+	// ones SCAN happens to return.
+	if infos, _ := store.List(ctx, "", 2); len(infos) != 2 || infos[0].Query != "iphone 15" || infos[1].Query != "iphone 15 pro" {
+		t.Fatalf("List() with limit = %#v", infos)
+	}
+	// Glob characters in the prefix are literal.
+	if infos, _ := store.List(ctx, "tv*", 0); len(infos) != 1 {
+		t.Fatalf("List(tv*) = %#v", infos)
+	}
+
+	if n, err := store.Delete(ctx, "iphone 15"); err != nil || n != 1 {
+		t.Fatalf("Delete() = %d, %v", n, err)
+	}
+	if n, err := store.DeletePrefix(ctx, "iphone"); err != nil || n != 1 {
+		t.Fatalf("DeletePrefix() = %d, %v", n, err)
+	}
+	if n, err := store.DeletePrefix(ctx, ""); err != nil || n != 1 {
+		t.Fatalf("DeletePrefix(all) = %d, %v", n, err)
+	}
+	if !server.Exists("other-app:key") {
+		t.Fatal("DeletePrefix() removed a key outside the cache namespace")
+	}
+}
+
+func TestTieredDeletesFromBothTiers(t *testing.T) {
+	remote, server := newTestRedis(t)
+	ctx := context.Background()
+	memory := NewMemory(10)
+	tiered := NewTiered(memory, remote, time.Minute)
+	tiered.Set(ctx, "phone", entry("wb:1"), time.Hour)
+	tiered.Set(ctx, "tv", entry("wb:2"), time.Hour)
+
+	if n, err := tiered.Delete(ctx, "phone"); err != nil || n != 1 {
+		t.Fatalf("Delete() = %d, %v", n, err)
+	}
+	if _, err := tiered.Get(ctx, "phone"); err == nil {
+		t.Fatal("Get() found a deleted query")
+	}
+	if n, err := tiered.DeletePrefix(ctx, ""); err != nil || n != 1 {
+		t.Fatalf("DeletePrefix() = %d, %v", n, err)
+	}
+	if memory.Len() != 0 || len(server.Keys()) != 0 {
+		t.Fatalf("memory = %d entries, Redis keys = %v", memory.Len(), server.Keys())
+	}
+}
+
+func TestMemoryList(t *testing.T) {
+	ctx := context.Background()
+	memory := NewMemory(10)
+	memory.Set(ctx, "phone", entry("wb:1"), time.Minute)
+	memory.Set(ctx, "tv", entry("wb:2"), time.Minute)
+
+	infos, err := memory.List(ctx, "ph", 0)
+	if err != nil || len(infos) != 1 || infos[0].Query != "phone" || infos[0].SizeBytes == 0 {
+		t.Fatalf("List() = %#v, %v", infos, err)
+	}
+}
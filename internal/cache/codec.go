@@ -0,0 +1,78 @@
+package cache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"agregator/internal/search"
+)
+
+// schemaVersion must be increased whenever search.Entry or product.Product
+// changes incompatibly. It is part of the key and of the value, so entries of
+// other versions are never decoded.
+const schemaVersion = 1
+
+// Every value starts with a format byte and the schema version.
+const (
+	formatJSON byte = 'j'
+	formatGzip byte = 'z'
+)
+
+// compressThreshold is the JSON size from which values are gzipped.
+const compressThreshold = 1024
+
+func encodeEntry(entry search.Entry) ([]byte, error) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return nil, fmt.Errorf("encode products for cache: %w", err)
+	}
+	if len(data) < compressThreshold {
+		return append([]byte{formatJSON, schemaVersion}, data...), nil
+	}
+
+	var buf bytes.Buffer
+	buf.Write([]byte{formatGzip, schemaVersion})
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, fmt.Errorf("compress cache entry: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("compress cache entry: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeEntry reports values written by other versions, including the
+// unprefixed JSON of older releases, as ErrMiss.
+func decodeEntry(value []byte) (search.Entry, error) {
+	if len(value) < 2 {
+		return search.Entry{}, fmt.Errorf("%w: truncated entry", ErrMiss)
+	}
+	format, version, data := value[0], value[1], value[2:]
+	if version != schemaVersion {
+		return search.Entry{}, fmt.Errorf("%w: schema version %d", ErrMiss, version)
+	}
+
+	switch format {
+	case formatJSON:
+	case formatGzip:
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return search.Entry{}, fmt.Errorf("decompress cache entry: %w", err)
+		}
+		if data, err = io.ReadAll(zr); err != nil {
+			return search.Entry{}, fmt.Errorf("decompress cache entry: %w", err)
+		}
+	default:
+		return search.Entry{}, fmt.Errorf("%w: unknown format %q", ErrMiss, format)
+	}
+
+	var entry search.Entry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return search.Entry{}, fmt.Errorf("decode cached products: %w", err)
+	}
+	return entry, nil
+}
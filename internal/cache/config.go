@@ -0,0 +1,142 @@
+package cache
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Config describes how to reach Redis. URL (redis:// or rediss://) supplies the
+// address, credentials, DB and TLS of a node; the other fields override it.
+// With MasterName the addresses are Sentinel nodes; with Cluster, or with
+// several addresses and no master name, they are seed nodes of a cluster.
+type Config struct {
+	URL              string
+	Addrs            []string
+	Username         string
+	Password         string
+	DB               int
+	MasterName       string
+	SentinelPassword string
+	Cluster          bool
+	TLS              bool
+	CAFile           string
+	KeyPrefix        string
+}
+
+// ConfigFromEnv reads the REDIS_* environment variables.
+func ConfigFromEnv() (Config, error) {
+	config := Config{
+		URL:              os.Getenv("REDIS_URL"),
+		Username:         os.Getenv("REDIS_USERNAME"),
+		Password:         os.Getenv("REDIS_PASSWORD"),
+		MasterName:       os.Getenv("REDIS_SENTINEL_MASTER"),
+		SentinelPassword: os.Getenv("REDIS_SENTINEL_PASSWORD"),
+		CAFile:           os.Getenv("REDIS_TLS_CA_FILE"),
+		KeyPrefix:        os.Getenv("REDIS_KEY_PREFIX"),
+	}
+	for _, addr := range strings.Split(os.Getenv("REDIS_ADDR"), ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			config.Addrs = append(config.Addrs, addr)
+		}
+	}
+	if value := os.Getenv("REDIS_DB"); value != "" {
+		db, err := strconv.Atoi(value)
+		if err != nil || db < 0 {
+			return Config{}, fmt.Errorf("REDIS_DB must be a non-negative integer")
+		}
+		config.DB = db
+	}
+	var err error
+	if config.Cluster, err = envBool("REDIS_CLUSTER"); err != nil {
+		return Config{}, err
+	}
+	if config.TLS, err = envBool("REDIS_TLS"); err != nil {
+		return Config{}, err
+	}
+	return config, nil
+}
+
+func envBool(name string) (bool, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("%s must be true or false", name)
+	}
+	return b, nil
+}
+
+func (c Config) options() (*redis.UniversalOptions, error) {
+	options := &redis.UniversalOptions{
+		Addrs:            c.Addrs,
+		Username:         c.Username,
+		Password:         c.Password,
+		DB:               c.DB,
+		MasterName:       c.MasterName,
+		SentinelPassword: c.SentinelPassword,
+	}
+	if c.URL != "" {
+		parsed, err := redis.ParseURL(c.URL)
+		if err != nil {
+			return nil, fmt.Errorf("parse REDIS_URL: %w", err)
+		}
+		if len(options.Addrs) == 0 {
+			options.Addrs = []string{parsed.Addr}
+		}
+		if options.Username == "" {
+			options.Username = parsed.Username
+		}
+		if options.Password == "" {
+			options.Password = parsed.Password
+		}
+		if options.DB == 0 {
+			options.DB = parsed.DB
+		}
+		options.TLSConfig = parsed.TLSConfig
+	}
+	if len(options.Addrs) == 0 {
+		options.Addrs = []string{defaultAddress}
+	}
+
+	if c.TLS || c.CAFile != "" {
+		if options.TLSConfig == nil {
+			host, _, err := net.SplitHostPort(options.Addrs[0])
+			if err != nil {
+				return nil, fmt.Errorf("parse Redis address: %w", err)
+			}
+			options.TLSConfig = &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}
+		}
+		if c.CAFile != "" {
+			pem, err := os.ReadFile(c.CAFile)
+			if err != nil {
+				return nil, fmt.Errorf("read Redis CA file: %w", err)
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificates in Redis CA file %s", c.CAFile)
+			}
+			options.TLSConfig.RootCAs = pool
+		}
+	}
+	return options, nil
+}
+
+func (c Config) client() (redis.UniversalClient, error) {
+	options, err := c.options()
+	if err != nil {
+		return nil, err
+	}
+	if c.Cluster {
+		return redis.NewClusterClient(options.Cluster()), nil
+	}
+	return redis.NewUniversalClient(options), nil
+}
@@ -0,0 +1,153 @@
+package cache
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+func TestNewConnectsWithURL(t *testing.T) {
+	server := miniredis.RunT(t)
+	server.RequireUserAuth("cache", "secret")
+
+	store, err := New(Config{URL: "redis://cache:secret@" + server.Addr() + "/3", KeyPrefix: "test"})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+
+	if err := store.Set(context.Background(), "phone", entry("wb:1"), time.Minute); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	if !server.DB(3).Exists("test:search:v1:phone") {
+		t.Fatal("entry not stored in DB 3 under the key prefix")
+	}
+}
+
+func TestNewConnectsToCluster(t *testing.T) {
+	server := miniredis.RunT(t)
+
+	store, err := New(Config{Addrs: []string{server.Addr()}, Cluster: true})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	if _, ok := store.client.(*redis.ClusterClient); !ok {
+		t.Fatalf("client = %T, want *redis.ClusterClient", store.client)
+	}
+
+	ctx := context.Background()
+	if err := store.Set(ctx, "phone", entry("wb:1"), time.Minute); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	if got, err := store.Get(ctx, "phone"); err != nil || got.Products[0].Key != "wb:1" {
+		t.Fatalf("Get() = %#v, %v", got, err)
+	}
+}
+
+func TestNewVerifiesTLSWithCustomCA(t *testing.T) {
+	certificate, caFile := newTestCertificate(t)
+	server, err := miniredis.RunTLS(&tls.Config{Certificates: []tls.Certificate{certificate}})
+	if err != nil {
+		t.Fatalf("start TLS server: %v", err)
+	}
+	t.Cleanup(server.Close)
+
+	trusted, err := New(Config{URL: "rediss://" + server.Addr(), CAFile: caFile})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	t.Cleanup(func() { _ = trusted.Close() })
+	if err := trusted.Ping(context.Background()); err != nil {
+		t.Fatalf("Ping() with custom CA error = %v", err)
+	}
+
+	untrusted, err := New(Config{Addrs: []string{server.Addr()}, TLS: true})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	t.Cleanup(func() { _ = untrusted.Close() })
+	if err := untrusted.Ping(context.Background()); err == nil {
+		t.Fatal("Ping() without custom CA succeeded")
+	}
+
+	if _, err := New(Config{Addrs: []string{server.Addr()}, CAFile: filepath.Join(t.TempDir(), "missing.pem")}); err == nil {
+		t.Fatal("New() accepted a missing CA file")
+	}
+}
+
+func TestConfigFromEnvForSentinel(t *testing.T) {
+	t.Setenv("REDIS_ADDR", "sentinel-1:26379, sentinel-2:26379")
+	t.Setenv("REDIS_USERNAME", "app")
+	t.Setenv("REDIS_PASSWORD", "secret")
+	t.Setenv("REDIS_DB", "2")
+	t.Setenv("REDIS_SENTINEL_MASTER", "cache")
+	t.Setenv("REDIS_SENTINEL_PASSWORD", "sentinel-secret")
+	t.Setenv("REDIS_TLS", "true")
+
+	config, err := ConfigFromEnv()
+	if err != nil {
+		t.Fatalf("ConfigFromEnv() error = %v", err)
+	}
+	options, err := config.options()
+	if err != nil {
+		t.Fatalf("options() error = %v", err)
+	}
+	if len(options.Addrs) != 2 || options.Addrs[1] != "sentinel-2:26379" || options.MasterName != "cache" ||
+		options.Username != "app" || options.Password != "secret" || options.SentinelPassword != "sentinel-secret" || options.DB != 2 {
+		t.Fatalf("options = %#v", options)
+	}
+	if options.TLSConfig == nil || options.TLSConfig.ServerName != "sentinel-1" {
+		t.Fatalf("TLS config = %#v", options.TLSConfig)
+	}
+
+	t.Setenv("REDIS_DB", "first")
+	if _, err := ConfigFromEnv(); err == nil {
+		t.Fatal("ConfigFromEnv() accepted an invalid REDIS_DB")
+	}
+}
+
+// newTestCertificate creates a self-signed certificate for 127.0.0.1 and
+// writes it to a PEM file that serves as the CA.
+func newTestCertificate(t *testing.T) (tls.Certificate, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "redis test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("write CA file: %v", err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, caFile
+}
@@ -0,0 +1,83 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"agregator/internal/search"
+)
+
+// ErrMiss is returned by Memory when the query is not cached or has expired.
+var ErrMiss = errors.New("cache miss")
+
+// Memory is an in-process LRU cache with a TTL per entry.
+type Memory struct {
+	mu    sync.Mutex
+	size  int
+	items map[string]*list.Element
+	order *list.List
+	now   func() time.Time
+}
+
+type memoryItem struct {
+	query   string
+	entry   search.Entry
+	expires time.Time
+}
+
+// NewMemory creates a cache that keeps at most size entries, evicting the least
+// recently used one.
+func NewMemory(size int) *Memory {
+	if size < 1 {
+		size = 1
+	}
+	return &Memory{size: size, items: make(map[string]*list.Element), order: list.New(), now: time.Now}
+}
+
+func (m *Memory) Get(_ context.Context, query string) (search.Entry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	element, ok := m.items[query]
+	if !ok {
+		return search.Entry{}, ErrMiss
+	}
+	item := element.Value.(*memoryItem)
+	if !m.now().Before(item.expires) {
+		m.remove(element)
+		return search.Entry{}, ErrMiss
+	}
+	m.order.MoveToFront(element)
+	return item.entry, nil
+}
+
+func (m *Memory) Set(_ context.Context, query string, entry search.Entry, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	expires := m.now().Add(ttl)
+	if element, ok := m.items[query]; ok {
+		item := element.Value.(*memoryItem)
+		item.entry, item.expires = entry, expires
+		m.order.MoveToFront(element)
+		return nil
+	}
+	m.items[query] = m.order.PushFront(&memoryItem{query: query, entry: entry, expires: expires})
+	for m.order.Len() > m.size {
+		m.remove(m.order.Back())
+	}
+	return nil
+}
+
+// Len returns the number of entries, including expired ones not yet evicted.
+func (m *Memory) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.order.Len()
+}
+
+func (m *Memory) remove(element *list.Element) {
+	m.order.Remove(element)
+	delete(m.items, element.Value.(*memoryItem).query)
+}
@@ -0,0 +1,60 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"agregator/internal/product"
+	"agregator/internal/search"
+)
+
+func entry(key string) search.Entry {
+	return search.Entry{Products: []product.Product{{Key: key}}}
+}
+
+func TestMemoryEvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	memory := NewMemory(2)
+	memory.Set(ctx, "a", entry("a"), time.Minute)
+	memory.Set(ctx, "b", entry("b"), time.Minute)
+	if _, err := memory.Get(ctx, "a"); err != nil {
+		t.Fatalf("Get(a) error = %v", err)
+	}
+	memory.Set(ctx, "c", entry("c"), time.Minute)
+
+	if _, err := memory.Get(ctx, "b"); !errors.Is(err, ErrMiss) {
+		t.Fatalf("Get(b) error = %v, want ErrMiss", err)
+	}
+	for _, query := range []string{"a", "c"} {
+		got, err := memory.Get(ctx, query)
+		if err != nil || got.Products[0].Key != query {
+			t.Fatalf("Get(%s) = %#v, %v", query, got, err)
+		}
+	}
+	if memory.Len() != 2 {
+		t.Fatalf("Len() = %d, want 2", memory.Len())
+	}
+}
+
+func TestMemoryExpiresEntries(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	memory := NewMemory(10)
+	memory.now = func() time.Time { return now }
+
+	memory.Set(ctx, "phone", entry("old"), time.Minute)
+	memory.Set(ctx, "phone", entry("new"), 2*time.Minute)
+	now = now.Add(90 * time.Second)
+	if got, err := memory.Get(ctx, "phone"); err != nil || got.Products[0].Key != "new" {
+		t.Fatalf("Get() = %#v, %v", got, err)
+	}
+	now = now.Add(time.Minute)
+	if _, err := memory.Get(ctx, "phone"); !errors.Is(err, ErrMiss) {
+		t.Fatalf("Get() error = %v, want ErrMiss", err)
+	}
+	if memory.Len() != 0 {
+		t.Fatalf("Len() = %d, want expired entry removed", memory.Len())
+	}
+}
@@ -2,57 +2,104 @@ package cache
 
 import (
 	"context"
-	"encoding/json"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
-	"os"
 	"time"
 
-	"agregator/internal/product"
+	"agregator/internal/search"
 
 	"github.com/go-redis/redis/v8"
 )
 
-const defaultAddress = "localhost:6379"
+const (
+	defaultAddress   = "localhost:6379"
+	defaultKeyPrefix = "agregator"
+)
 
 type Redis struct {
-	client *redis.Client
+	client redis.UniversalClient
+	prefix string
+}
+
+func New(config Config) (*Redis, error) {
+	client, err := config.client()
+	if err != nil {
+		return nil, err
+	}
+	prefix := config.KeyPrefix
+	if prefix == "" {
+		prefix = defaultKeyPrefix
+	}
+	return &Redis{client: client, prefix: prefix}, nil
 }
 
-func NewFromEnv() *Redis {
-	address := os.Getenv("REDIS_ADDR")
-	if address == "" {
-		address = defaultAddress
+func NewFromEnv() (*Redis, error) {
+	config, err := ConfigFromEnv()
+	if err != nil {
+		return nil, err
 	}
+	return New(config)
+}
 
-	return &Redis{client: redis.NewClient(&redis.Options{
-		Addr:     address,
-		Password: os.Getenv("REDIS_PASSWORD"),
-	})}
+// searchKey namespaces the keys of the cache and includes the schema version,
+// e.g. "agregator:search:v1:iphone 15".
+func (r *Redis) searchKey(query string) string {
+	return fmt.Sprintf("%s:search:v%d:%s", r.prefix, schemaVersion, query)
+}
+
+func (r *Redis) lockKey(query string) string {
+	return r.prefix + ":lock:" + query
 }
 
 func (r *Redis) Ping(ctx context.Context) error {
 	return r.client.Ping(ctx).Err()
 }
 
-func (r *Redis) Get(ctx context.Context, query string) ([]product.Product, error) {
-	value, err := r.client.Get(ctx, query).Result()
+func (r *Redis) Get(ctx context.Context, query string) (search.Entry, error) {
+	value, err := r.client.Get(ctx, r.searchKey(query)).Bytes()
 	if err != nil {
-		return nil, err
+		return search.Entry{}, err
 	}
+	return decodeEntry(value)
+}
 
-	var products []product.Product
-	if err := json.Unmarshal([]byte(value), &products); err != nil {
-		return nil, fmt.Errorf("decode cached products: %w", err)
+// Set stores entry for ttl, which should be the hard TTL of the search
+// service: stale entries must outlive the soft TTL to be served.
+func (r *Redis) Set(ctx context.Context, query string, entry search.Entry, ttl time.Duration) error {
+	value, err := encodeEntry(entry)
+	if err != nil {
+		return err
 	}
-	return products, nil
+	return r.client.Set(ctx, r.searchKey(query), value, ttl).Err()
 }
 
-func (r *Redis) Set(ctx context.Context, query string, products []product.Product) error {
-	value, err := json.Marshal(products)
-	if err != nil {
-		return fmt.Errorf("encode products for cache: %w", err)
+// unlockScript deletes the lock only if it still holds our token, so an expired
+// lock taken over by another replica is never released by mistake.
+var unlockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+// TryLock implements search.Locker with SET NX PX.
+func (r *Redis) TryLock(ctx context.Context, key string, ttl time.Duration) (func(), bool, error) {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return nil, false, fmt.Errorf("generate lock token: %w", err)
+	}
+	value := hex.EncodeToString(token)
+	key = r.lockKey(key)
+
+	ok, err := r.client.SetNX(ctx, key, value, ttl).Result()
+	if err != nil || !ok {
+		return nil, false, err
 	}
-	return r.client.Set(ctx, query, value, time.Hour).Err()
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = unlockScript.Run(ctx, r.client, []string{key}, value).Err()
+	}, true, nil
 }
 
 func (r *Redis) Close() error {
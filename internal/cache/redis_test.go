@@ -2,35 +2,124 @@ package cache
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"testing"
+	"time"
 
 	"agregator/internal/product"
+	"agregator/internal/search"
 
 	"github.com/alicebob/miniredis/v2"
 	"github.com/go-redis/redis/v8"
 )
 
-func TestRedisSetAndGet(t *testing.T) {
+func newTestRedis(t *testing.T) (*Redis, *miniredis.Miniredis) {
+	t.Helper()
 	server := miniredis.RunT(t)
-	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
-	store := &Redis{client: client}
+	store := &Redis{client: redis.NewClient(&redis.Options{Addr: server.Addr()}), prefix: defaultKeyPrefix}
 	t.Cleanup(func() { _ = store.Close() })
+	return store, server
+}
 
-	want := []product.Product{{
-		ProductID:            "42",
-		ProductName:          "Phone",
-		DiscountPriceKopecks: 123_400,
-		BasePriceKopecks:     150_000,
-	}}
-	if err := store.Set(context.Background(), "phone", want); err != nil {
+func TestRedisSetAndGet(t *testing.T) {
+	store, server := newTestRedis(t)
+
+	want := search.Entry{
+		Products: []product.Product{{
+			ProductID:            "42",
+			ProductName:          "Phone",
+			DiscountPriceKopecks: 123_400,
+			BasePriceKopecks:     150_000,
+		}},
+		Sources:   []search.SourceStatus{{Marketplace: "wb", Status: search.StatusOK, Count: 1}},
+		FetchedAt: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+	}
+	if err := store.Set(context.Background(), "phone", want, 30*time.Minute); err != nil {
 		t.Fatalf("Set() error = %v", err)
 	}
+	if ttl := server.TTL("agregator:search:v1:phone"); ttl != 30*time.Minute {
+		t.Fatalf("TTL = %v, want 30m", ttl)
+	}
 
 	got, err := store.Get(context.Background(), "phone")
 	if err != nil {
 		t.Fatalf("Get() error = %v", err)
 	}
-	if len(got) != 1 || got[0] != want[0] {
+	if len(got.Products) != 1 || got.Products[0] != want.Products[0] || !got.FetchedAt.Equal(want.FetchedAt) {
 		t.Fatalf("Get() = %#v, want %#v", got, want)
 	}
+	if len(got.Sources) != 1 || got.Sources[0] != want.Sources[0] {
+		t.Fatalf("Get() sources = %#v, want %#v", got.Sources, want.Sources)
+	}
+}
+
+func TestRedisCompressesLargeEntries(t *testing.T) {
+	store, server := newTestRedis(t)
+
+	var want search.Entry
+	for i := 0; i < 100; i++ {
+		want.Products = append(want.Products, product.Product{ProductID: fmt.Sprint(i), ProductName: "Смартфон Apple iPhone 15 128 ГБ"})
+	}
+	if err := store.Set(context.Background(), "iphone", want, time.Hour); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	value, err := server.Get("agregator:search:v1:iphone")
+	if err != nil {
+		t.Fatalf("read raw value: %v", err)
+	}
+	if value[0] != formatGzip || value[1] != schemaVersion {
+		t.Fatalf("header = %q, want gzip of version %d", value[:2], schemaVersion)
+	}
+
+	got, err := store.Get(context.Background(), "iphone")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if len(got.Products) != 100 || got.Products[99].ProductID != "99" {
+		t.Fatalf("Get() products = %d", len(got.Products))
+	}
+}
+
+func TestRedisTreatsOtherVersionsAsMiss(t *testing.T) {
+	store, server := newTestRedis(t)
+	for name, value := range map[string]string{
+		"legacy JSON":    `{"products":[],"fetched_at":"2024-05-01T12:00:00Z"}`,
+		"newer version":  string([]byte{formatJSON, schemaVersion + 1}) + `{}`,
+		"unknown format": string([]byte{'x', schemaVersion}) + `{}`,
+		"truncated":      "j",
+	} {
+		server.Set("agregator:search:v1:phone", value)
+		if _, err := store.Get(context.Background(), "phone"); !errors.Is(err, ErrMiss) {
+			t.Fatalf("%s: Get() error = %v, want ErrMiss", name, err)
+		}
+	}
+}
+
+func TestRedisTryLock(t *testing.T) {
+	store, server := newTestRedis(t)
+	ctx := context.Background()
+
+	unlock, ok, err := store.TryLock(ctx, "phone", time.Minute)
+	if err != nil || !ok {
+		t.Fatalf("TryLock() = %t, %v", ok, err)
+	}
+	if _, ok, err := store.TryLock(ctx, "phone", time.Minute); err != nil || ok {
+		t.Fatalf("second TryLock() = %t, %v, want lock held", ok, err)
+	}
+
+	// An expired lock taken by another replica must survive our unlock.
+	server.FastForward(2 * time.Minute)
+	other, ok, err := store.TryLock(ctx, "phone", time.Minute)
+	if err != nil || !ok {
+		t.Fatalf("TryLock() after expiry = %t, %v", ok, err)
+	}
+	unlock()
+	if !server.Exists("agregator:lock:phone") {
+		t.Fatal("unlock released a lock held by another replica")
+	}
+	other()
+	if server.Exists("agregator:lock:phone") {
+		t.Fatal("lock not released")
+	}
 }
@@ -0,0 +1,54 @@
+package cache
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"agregator/internal/search"
+)
+
+// Tiered checks the in-process cache before the shared one and writes to both.
+// Entries stay in memory for at most memoryTTL, so that results refreshed by
+// other replicas are picked up soon.
+type Tiered struct {
+	memory    *Memory
+	remote    search.Cache
+	memoryTTL time.Duration
+}
+
+func NewTiered(memory *Memory, remote search.Cache, memoryTTL time.Duration) *Tiered {
+	return &Tiered{memory: memory, remote: remote, memoryTTL: memoryTTL}
+}
+
+func (t *Tiered) Get(ctx context.Context, query string) (search.Entry, error) {
+	if entry, err := t.memory.Get(ctx, query); err == nil {
+		return entry, nil
+	}
+	entry, err := t.remote.Get(ctx, query)
+	if err != nil {
+		return search.Entry{}, err
+	}
+	_ = t.memory.Set(ctx, query, entry, t.memoryTTL)
+	return entry, nil
+}
+
+func (t *Tiered) Set(ctx context.Context, query string, entry search.Entry, ttl time.Duration) error {
+	_ = t.memory.Set(ctx, query, entry, min(ttl, t.memoryTTL))
+	return t.remote.Set(ctx, query, entry, ttl)
+}
+
+// TryLock delegates to the shared cache when it coordinates replicas.
+func (t *Tiered) TryLock(ctx context.Context, key string, ttl time.Duration) (func(), bool, error) {
+	if locker, ok := t.remote.(search.Locker); ok {
+		return locker.TryLock(ctx, key, ttl)
+	}
+	return func() {}, true, nil
+}
+
+func (t *Tiered) Close() error {
+	if closer, ok := t.remote.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTieredPopulatesBothTiers(t *testing.T) {
+	remote, server := newTestRedis(t)
+	ctx := context.Background()
+
+	memory := NewMemory(10)
+	tiered := NewTiered(memory, remote, time.Minute)
+	if err := tiered.Set(ctx, "phone", entry("wb:1"), time.Hour); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	if ttl := server.TTL("agregator:search:v1:phone"); ttl != time.Hour {
+		t.Fatalf("Redis TTL = %v, want 1h", ttl)
+	}
+
+	// Memory answers without a round-trip to Redis.
+	server.Del("agregator:search:v1:phone")
+	if got, err := tiered.Get(ctx, "phone"); err != nil || got.Products[0].Key != "wb:1" {
+		t.Fatalf("Get() from memory = %#v, %v", got, err)
+	}
+
+	// A result stored by another replica is copied into memory.
+	if err := remote.Set(ctx, "tv", entry("ozon:2"), time.Hour); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	if got, err := tiered.Get(ctx, "tv"); err != nil || got.Products[0].Key != "ozon:2" {
+		t.Fatalf("Get() from Redis = %#v, %v", got, err)
+	}
+	server.Del("agregator:search:v1:tv")
+	if _, err := memory.Get(ctx, "tv"); err != nil {
+		t.Fatalf("memory Get() error = %v", err)
+	}
+
+	if _, ok, err := tiered.TryLock(ctx, "phone", time.Minute); err != nil || !ok {
+		t.Fatalf("TryLock() = %t, %v", ok, err)
+	}
+	if !server.Exists("agregator:lock:phone") {
+		t.Fatal("TryLock() did not lock in Redis")
+	}
+}
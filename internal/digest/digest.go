@@ -0,0 +1,280 @@
+package digest
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"strings"
+	"time"
+
+	"agregator/internal/history"
+	"agregator/internal/product"
+	"agregator/internal/search"
+	"agregator/internal/watch"
+)
+
+// Period is how often the digests are sent.
+type Period string
+
+const (
+	Daily  Period = "daily"
+	Weekly Period = "weekly"
+)
+
+func ParsePeriod(value string) (Period, error) {
+	switch period := Period(strings.ToLower(strings.TrimSpace(value))); period {
+	case Daily, Weekly:
+		return period, nil
+	default:
+		return "", fmt.Errorf("unknown digest period %q", value)
+	}
+}
+
+func (p Period) duration() time.Duration {
+	if p == Weekly {
+		return 7 * 24 * time.Hour
+	}
+	return 24 * time.Hour
+}
+
+const (
+	// notableDrop is the price drop in percent that puts an offer into the
+	// drops section.
+	notableDrop = 5
+	// referenceWindow is how far before the period the price it started with
+	// is looked up.
+	referenceWindow = 30 * 24 * time.Hour
+)
+
+// Sender delivers a message with an HTML body.
+type Sender interface {
+	Send(ctx context.Context, to, subject, html string) error
+}
+
+// PriceHistory is the part of the history store the digest needs.
+type PriceHistory interface {
+	History(ctx context.Context, marketplace, productID string, since time.Time) (history.History, error)
+}
+
+type Options struct {
+	Period Period
+	// Hour is the local hour the digests are sent at.
+	Hour int
+	// Labels maps marketplace names to the names shown to users.
+	Labels map[string]string
+}
+
+// Mailer sends the owners of watches named "email:<address>" a digest of
+// them: the best current offer of each subscription and the offers that got
+// notably cheaper over the period.
+type Mailer struct {
+	watches *watch.Store
+	search  *search.Service
+	prices  PriceHistory
+	sender  Sender
+	options Options
+	logger  *slog.Logger
+	now     func() time.Time
+}
+
+// New creates a mailer. prices may be nil, then the digests have no drops.
+func New(logger *slog.Logger, watches *watch.Store, searchService *search.Service, prices PriceHistory, sender Sender, options Options) *Mailer {
+	if options.Period == "" {
+		options.Period = Daily
+	}
+	return &Mailer{
+		logger:  logger,
+		watches: watches,
+		search:  searchService,
+		prices:  prices,
+		sender:  sender,
+		options: options,
+		now:     time.Now,
+	}
+}
+
+// Run sends the digests at the configured hour, every day or every Monday,
+// until ctx is done. A digest missed while the process was stopped is not
+// sent later.
+func (m *Mailer) Run(ctx context.Context) {
+	for {
+		next := m.next(m.now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Until(next)):
+		}
+		if err := m.Deliver(ctx, next); err != nil {
+			m.logger.Error("deliver digests", "error", err)
+		}
+	}
+}
+
+func (m *Mailer) next(now time.Time) time.Time {
+	next := time.Date(now.Year(), now.Month(), now.Day(), m.options.Hour, 0, 0, 0, now.Location())
+	step := 1
+	if m.options.Period == Weekly {
+		next = next.AddDate(0, 0, (int(time.Monday)-int(next.Weekday())+7)%7)
+		step = 7
+	}
+	if !next.After(now) {
+		next = next.AddDate(0, 0, step)
+	}
+	return next
+}
+
+// Digest is the data of one message.
+type Digest struct {
+	Period Period
+	Since  time.Time
+	Until  time.Time
+	Items  []Item
+	Drops  []Item
+}
+
+// Item is a subscription with its best current offer. Offer is nil when
+// nothing was found or, with Failed, when the search failed.
+type Item struct {
+	Subscription         watch.Subscription
+	Offer                *product.Product
+	Label                string
+	Failed               bool
+	PreviousPriceKopecks int64
+	DropPercent          float64
+}
+
+// Deliver sends every email owner the digest of the period ending at until.
+// Each query is searched once, through the cache.
+func (m *Mailer) Deliver(ctx context.Context, until time.Time) error {
+	subs, err := m.watches.List(ctx, "")
+	if err != nil {
+		return err
+	}
+	byOwner := make(map[string][]watch.Subscription)
+	var owners []string
+	for _, sub := range subs {
+		if !strings.HasPrefix(sub.Owner, watch.OwnerEmail) {
+			continue
+		}
+		if _, ok := byOwner[sub.Owner]; !ok {
+			owners = append(owners, sub.Owner)
+		}
+		byOwner[sub.Owner] = append(byOwner[sub.Owner], sub)
+	}
+
+	results := make(map[string]queryResult)
+	var errs []error
+	for _, owner := range owners {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		digest := m.build(ctx, byOwner[owner], until, results)
+		subject, body, err := render(digest)
+		if err != nil {
+			return err
+		}
+		to := strings.TrimPrefix(owner, watch.OwnerEmail)
+		if err := m.sender.Send(ctx, to, subject, body); err != nil {
+			errs = append(errs, fmt.Errorf("send digest to %s: %w", to, err))
+			continue
+		}
+		m.logger.Info("digest sent", "to", to, "subscriptions", len(digest.Items), "drops", len(digest.Drops))
+	}
+	return errors.Join(errs...)
+}
+
+type queryResult struct {
+	products []product.Product
+	failed   bool
+}
+
+func (m *Mailer) build(ctx context.Context, subs []watch.Subscription, until time.Time, results map[string]queryResult) Digest {
+	digest := Digest{Period: m.options.Period, Since: until.Add(-m.options.Period.duration()), Until: until}
+	for _, sub := range subs {
+		result, ok := results[sub.Query]
+		if !ok {
+			result = m.searchQuery(ctx, sub.Query)
+			results[sub.Query] = result
+		}
+		item := Item{Subscription: sub, Failed: result.failed}
+		if offer, ok := sub.Offer(result.products); ok {
+			item.Offer = &offer
+			item.Label = marketplaceLabel(offer.Marketplace, m.options.Labels)
+			if previous, ok := m.previousPrice(ctx, offer, digest.Since); ok && previous > offer.DiscountPriceKopecks {
+				item.PreviousPriceKopecks = previous
+				item.DropPercent = float64(previous-offer.DiscountPriceKopecks) * 100 / float64(previous)
+			}
+		}
+		digest.Items = append(digest.Items, item)
+		if item.DropPercent >= notableDrop {
+			digest.Drops = append(digest.Drops, item)
+		}
+	}
+	return digest
+}
+
+func (m *Mailer) searchQuery(ctx context.Context, query string) queryResult {
+	result, err := m.search.Search(ctx, query, search.Options{})
+	if err != nil && !errors.Is(err, search.ErrProductsNotFound) {
+		m.logger.Warn("digest search failed", "query", query, "error", err)
+		return queryResult{failed: true}
+	}
+	return queryResult{products: result.Products}
+}
+
+// previousPrice returns the price the offer had when the period started, or
+// its first price if it was first seen during the period.
+func (m *Mailer) previousPrice(ctx context.Context, offer product.Product, since time.Time) (int64, bool) {
+	if m.prices == nil || offer.ProductID == "" {
+		return 0, false
+	}
+	h, err := m.prices.History(ctx, offer.Marketplace, offer.ProductID, since.Add(-referenceWindow))
+	if err != nil {
+		if !errors.Is(err, history.ErrNotFound) {
+			m.logger.Warn("read price history for digest", "product", product.Key(offer.Marketplace, offer.ProductID), "error", err)
+		}
+		return 0, false
+	}
+	previous := h.Points[0]
+	for _, point := range h.Points[1:] {
+		if point.RecordedAt.After(since) {
+			break
+		}
+		previous = point
+	}
+	return previous.DiscountPriceKopecks, true
+}
+
+func marketplaceLabel(name string, labels map[string]string) string {
+	if label, ok := labels[name]; ok {
+		return label
+	}
+	return name
+}
+
+//go:embed digest.html
+var digestHTML string
+
+var digestTemplate = template.Must(template.New("digest").Funcs(template.FuncMap{
+	"price": product.FormatPrice,
+	"date":  func(t time.Time) string { return t.Format("02.01.2006") },
+}).Parse(digestHTML))
+
+func render(digest Digest) (string, string, error) {
+	subject := "Сводка цен за день"
+	if digest.Period == Weekly {
+		subject = "Сводка цен за неделю"
+	}
+	if len(digest.Drops) > 0 {
+		subject += fmt.Sprintf(": подешевело предложений — %d", len(digest.Drops))
+	}
+	var body bytes.Buffer
+	if err := digestTemplate.Execute(&body, digest); err != nil {
+		return "", "", fmt.Errorf("render digest: %w", err)
+	}
+	return subject, body.String(), nil
+}
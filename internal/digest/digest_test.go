@@ -0,0 +1,149 @@
+package digest
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"agregator/internal/history"
+	"agregator/internal/product"
+	"agregator/internal/search"
+	"agregator/internal/watch"
+)
+
+type fakeMarketplace struct{}
+
+func (fakeMarketplace) Name() string {
+	return "wb"
+}
+
+func (fakeMarketplace) Search(_ context.Context, query string) ([]product.Product, error) {
+	if query == "broken" {
+		return nil, errors.New("marketplace is down")
+	}
+	return []product.Product{
+		{Marketplace: "wb", ProductID: "1", ProductName: "Phone <mini>", Link: "https://example.com/1", DiscountPriceKopecks: 100_000},
+		{Marketplace: "wb", ProductID: "2", ProductName: "Phone max", DiscountPriceKopecks: 200_000},
+	}, nil
+}
+
+type message struct {
+	to, subject, html string
+}
+
+type recordingSender struct {
+	messages []message
+}
+
+func (s *recordingSender) Send(_ context.Context, to, subject, html string) error {
+	s.messages = append(s.messages, message{to: to, subject: subject, html: html})
+	return nil
+}
+
+func TestMailerDeliversDigests(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	watches, err := watch.Open(filepath.Join(dir, "watch.db"))
+	if err != nil {
+		t.Fatalf("watch.Open() error = %v", err)
+	}
+	defer watches.Close()
+	prices, err := history.Open(filepath.Join(dir, "history.db"))
+	if err != nil {
+		t.Fatalf("history.Open() error = %v", err)
+	}
+	defer prices.Close()
+
+	until := time.Date(2024, 5, 2, 9, 0, 0, 0, time.UTC)
+	// The cheapest phone cost 1 200 ₽ when the period started, the other one
+	// only got 1% cheaper.
+	record := func(at time.Time, id string, price int64) {
+		err := prices.Record(ctx, []product.Product{{Marketplace: "wb", ProductID: id, DiscountPriceKopecks: price}}, at)
+		if err != nil {
+			t.Fatalf("Record() error = %v", err)
+		}
+	}
+	record(until.Add(-72*time.Hour), "1", 150_000)
+	record(until.Add(-48*time.Hour), "1", 120_000)
+	record(until.Add(-time.Hour), "1", 100_000)
+	record(until.Add(-48*time.Hour), "2", 202_000)
+
+	for _, sub := range []watch.Subscription{
+		{Owner: "email:buyer@example.com", Query: "phone", TargetPriceKopecks: 90_000},
+		{Owner: "email:buyer@example.com", Query: "phone", Marketplace: "wb", ProductID: "2", DropPercent: 10},
+		{Owner: "email:buyer@example.com", Query: "broken", TargetPriceKopecks: 1_000},
+		{Owner: "telegram:42", Query: "phone", TargetPriceKopecks: 90_000},
+	} {
+		if _, err := watches.Add(ctx, sub); err != nil {
+			t.Fatalf("Add() error = %v", err)
+		}
+	}
+
+	sender := &recordingSender{}
+	service := search.New(slog.Default(), nil, fakeMarketplace{})
+	mailer := New(slog.Default(), watches, service, prices, sender, Options{Period: Daily, Hour: 9, Labels: map[string]string{"wb": "Wildberries"}})
+	if err := mailer.Deliver(ctx, until); err != nil {
+		t.Fatalf("Deliver() error = %v", err)
+	}
+
+	if len(sender.messages) != 1 {
+		t.Fatalf("sent %d digests, want 1", len(sender.messages))
+	}
+	got := sender.messages[0]
+	if got.to != "buyer@example.com" || got.subject != "Сводка цен за день: подешевело предложений — 1" {
+		t.Fatalf("message to %q with subject %q", got.to, got.subject)
+	}
+	drops, items, _ := strings.Cut(got.html, "<h2 style=\"font-size: 16px;\">Подписки</h2>")
+	for _, want := range []string{
+		`<a href="https://example.com/1">Phone &lt;mini&gt;</a> · Wildberries`,
+		"<b>1\u00a0000\u00a0₽</b> вместо <s>1\u00a0200\u00a0₽</s>, −17%",
+	} {
+		if !strings.Contains(drops, want) {
+			t.Fatalf("drops section misses %q:\n%s", want, drops)
+		}
+	}
+	if strings.Contains(drops, "Phone max") {
+		t.Fatalf("drops section contains an offer that is 1%% cheaper:\n%s", drops)
+	}
+	for _, want := range []string{
+		"не дороже 900\u00a0₽",
+		"снижение на 10%",
+		"Phone max · Wildberries",
+		"<b>2\u00a0000\u00a0₽</b>",
+		"Не удалось проверить цену",
+		"01.05.2024 — 02.05.2024",
+	} {
+		if !strings.Contains(got.html, want) {
+			t.Fatalf("digest misses %q:\n%s", want, items)
+		}
+	}
+}
+
+func TestMailerNext(t *testing.T) {
+	// 2024-05-01 is a Wednesday.
+	now := time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC)
+	for _, tt := range []struct {
+		period Period
+		hour   int
+		want   time.Time
+	}{
+		{Daily, 9, time.Date(2024, 5, 2, 9, 0, 0, 0, time.UTC)},
+		{Daily, 18, time.Date(2024, 5, 1, 18, 0, 0, 0, time.UTC)},
+		{Weekly, 9, time.Date(2024, 5, 6, 9, 0, 0, 0, time.UTC)},
+	} {
+		mailer := New(slog.Default(), nil, nil, nil, nil, Options{Period: tt.period, Hour: tt.hour})
+		if got := mailer.next(now); !got.Equal(tt.want) {
+			t.Errorf("next(%s, %d) = %v, want %v", tt.period, tt.hour, got, tt.want)
+		}
+	}
+
+	monday := time.Date(2024, 5, 6, 9, 0, 0, 0, time.UTC)
+	mailer := New(slog.Default(), nil, nil, nil, nil, Options{Period: Weekly, Hour: 9})
+	if got := mailer.next(monday); !got.Equal(monday.AddDate(0, 0, 7)) {
+		t.Errorf("next at the sending time = %v, want a week later", got)
+	}
+}
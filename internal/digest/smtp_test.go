@@ -0,0 +1,172 @@
+package digest
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// sink is a minimal SMTP server that keeps the received messages.
+type sink struct {
+	listener net.Listener
+
+	mu       sync.Mutex
+	messages []sinkMessage
+}
+
+type sinkMessage struct {
+	auth string
+	from string
+	to   []string
+	data string
+}
+
+func newSink(t *testing.T) *sink {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	s := &sink{listener: listener}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *sink) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *sink) serve(conn net.Conn) {
+	defer conn.Close()
+	text := textproto.NewConn(conn)
+	text.PrintfLine("220 sink ready")
+	var message sinkMessage
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		command, args, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(command) {
+		case "EHLO":
+			text.PrintfLine("250-sink\r\n250 AUTH PLAIN")
+		case "AUTH":
+			decoded, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(args, "PLAIN "))
+			message.auth = string(decoded)
+			text.PrintfLine("235 accepted")
+		case "MAIL":
+			message.from = args
+			text.PrintfLine("250 ok")
+		case "RCPT":
+			message.to = append(message.to, args)
+			text.PrintfLine("250 ok")
+		case "DATA":
+			text.PrintfLine("354 go ahead")
+			data, err := text.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			message.data = string(data)
+			s.mu.Lock()
+			s.messages = append(s.messages, message)
+			s.mu.Unlock()
+			message = sinkMessage{}
+			text.PrintfLine("250 queued")
+		case "QUIT":
+			text.PrintfLine("221 bye")
+			return
+		default:
+			text.PrintfLine("502 not implemented")
+		}
+	}
+}
+
+func (s *sink) received() []sinkMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]sinkMessage(nil), s.messages...)
+}
+
+func TestSMTPSendsToSink(t *testing.T) {
+	sink := newSink(t)
+	sender, err := NewSMTP(SMTPConfig{
+		Host:     "127.0.0.1",
+		Port:     sink.port(),
+		Username: "user",
+		Password: "secret",
+		From:     "Агрегатор <digest@example.com>",
+		TLS:      TLSNone,
+	})
+	if err != nil {
+		t.Fatalf("NewSMTP() error = %v", err)
+	}
+
+	body := "<p>Цена: 1 000 ₽</p>\n." + strings.Repeat("x", 100)
+	if err := sender.Send(context.Background(), "buyer@example.com", "Сводка цен за день", body); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	messages := sink.received()
+	if len(messages) != 1 {
+		t.Fatalf("received %d messages, want 1", len(messages))
+	}
+	got := messages[0]
+	if got.auth != "\x00user\x00secret" || got.from != "FROM:<digest@example.com>" || len(got.to) != 1 || got.to[0] != "TO:<buyer@example.com>" {
+		t.Fatalf("envelope = %q %q %q", got.auth, got.from, got.to)
+	}
+	parsed, err := mail.ReadMessage(bufio.NewReader(strings.NewReader(got.data)))
+	if err != nil {
+		t.Fatalf("ReadMessage() error = %v", err)
+	}
+	subject, _ := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	if subject != "Сводка цен за день" || parsed.Header.Get("Content-Type") != "text/html; charset=utf-8" {
+		t.Fatalf("headers = %v", parsed.Header)
+	}
+	from, err := parsed.Header.AddressList("From")
+	if err != nil || from[0].Name != "Агрегатор" {
+		t.Fatalf("From = %v, %v", from, err)
+	}
+	decoded, err := io.ReadAll(quotedprintable.NewReader(parsed.Body))
+	if err != nil || strings.TrimSuffix(strings.ReplaceAll(string(decoded), "\r\n", "\n"), "\n") != body {
+		t.Fatalf("body = %q, %v", decoded, err)
+	}
+}
+
+func TestNewSMTPValidatesConfig(t *testing.T) {
+	for name, config := range map[string]SMTPConfig{
+		"no host":     {From: "digest@example.com"},
+		"bad sender":  {Host: "localhost", From: "digest"},
+		"unknown tls": {Host: "localhost", From: "digest@example.com", TLS: "ssl"},
+	} {
+		if _, err := NewSMTP(config); err == nil {
+			t.Errorf("%s: NewSMTP() error = nil", name)
+		}
+	}
+
+	sender, err := NewSMTP(SMTPConfig{Host: "smtp.example.com", From: "digest@example.com", TLS: TLSImplicit})
+	if err != nil || sender.config.Port != 465 {
+		t.Fatalf("implicit TLS port = %d, %v", sender.config.Port, err)
+	}
+	sender, _ = NewSMTP(SMTPConfig{Host: "smtp.example.com", From: "digest@example.com"})
+	if sender.config.TLS != TLSStartTLS || sender.config.Port != 587 {
+		t.Fatalf("default config = %+v", sender.config)
+	}
+}
@@ -0,0 +1,116 @@
+package history
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"agregator/internal/product"
+)
+
+const (
+	// checkWindow is how far back prices are compared with the current one.
+	checkWindow = 30 * 24 * time.Hour
+	// minObservations is the history needed for a verdict other than unknown.
+	minObservations = 3
+	// checkBatch keeps the parameters of one query well below SQLite's limit.
+	checkBatch = 400
+)
+
+// CheckPrices judges the discount of every product by the prices recorded in
+// the month before the given time. The result is keyed by product.Key. The
+// history is read with one query per checkBatch products, not per product.
+func (s *Store) CheckPrices(ctx context.Context, products []product.Product, before time.Time) (map[string]product.PriceCheck, error) {
+	var wanted []product.Product
+	seen := make(map[string]bool, len(products))
+	for _, p := range products {
+		key := product.Key(p.Marketplace, p.ProductID)
+		if seen[key] || p.ProductID == "" || p.DiscountPriceKopecks <= 0 {
+			continue
+		}
+		seen[key] = true
+		wanted = append(wanted, p)
+	}
+
+	checks := make(map[string]product.PriceCheck, len(wanted))
+	for start := 0; start < len(wanted); start += checkBatch {
+		batch := wanted[start:min(start+checkBatch, len(wanted))]
+		prices, err := s.recentPrices(ctx, batch, before)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range batch {
+			key := product.Key(p.Marketplace, p.ProductID)
+			checks[key] = check(p, prices[key])
+		}
+	}
+	return checks, nil
+}
+
+// recentPrices returns the prices of products recorded within checkWindow
+// before the given time, keyed by product.Key.
+func (s *Store) recentPrices(ctx context.Context, products []product.Product, before time.Time) (map[string][]int64, error) {
+	values := make([]string, len(products))
+	args := make([]any, 0, 2*len(products)+2)
+	for i, p := range products {
+		values[i] = "(?, ?)"
+		args = append(args, p.Marketplace, p.ProductID)
+	}
+	args = append(args, before.Add(-checkWindow).UnixMilli(), before.UnixMilli())
+	rows, err := s.db.QueryContext(ctx, `
+		WITH wanted (marketplace, product_id) AS (VALUES `+strings.Join(values, ", ")+`)
+		SELECT prices.marketplace, prices.product_id, prices.discount_price
+		FROM wanted JOIN prices
+			ON prices.marketplace = wanted.marketplace AND prices.product_id = wanted.product_id
+		WHERE prices.recorded_at >= ? AND prices.recorded_at < ?`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("check prices: %w", err)
+	}
+	defer rows.Close()
+
+	prices := make(map[string][]int64, len(products))
+	for rows.Next() {
+		var (
+			marketplace, productID string
+			price                  int64
+		)
+		if err := rows.Scan(&marketplace, &productID, &price); err != nil {
+			return nil, fmt.Errorf("check prices: %w", err)
+		}
+		key := product.Key(marketplace, productID)
+		prices[key] = append(prices[key], price)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("check prices: %w", err)
+	}
+	return prices, nil
+}
+
+// check compares the current price with the history. The base price counts as
+// charged when some recorded price was within 5% of it.
+func check(p product.Product, prices []int64) product.PriceCheck {
+	result := product.PriceCheck{Verdict: product.VerdictUnknown, Observations: len(prices)}
+	if len(prices) < minObservations {
+		return result
+	}
+	slices.Sort(prices)
+	middle := len(prices) / 2
+	result.MedianPriceKopecks = prices[middle]
+	if len(prices)%2 == 0 {
+		result.MedianPriceKopecks = (prices[middle-1] + prices[middle]) / 2
+	}
+	result.BelowMedian = p.DiscountPriceKopecks < result.MedianPriceKopecks
+	result.BasePriceCharged = p.BasePriceKopecks > 0 && prices[len(prices)-1]*100 >= p.BasePriceKopecks*95
+
+	switch {
+	case result.BelowMedian:
+		result.Verdict = product.VerdictReal
+	case p.DiscountPercent() > 0 && !result.BasePriceCharged:
+		result.Verdict = product.VerdictFake
+	default:
+		result.Verdict = product.VerdictRegular
+	}
+	return result
+}
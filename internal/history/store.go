@@ -0,0 +1,140 @@
+package history
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"agregator/internal/product"
+
+	_ "modernc.org/sqlite"
+)
+
+var ErrNotFound = errors.New("price history not found")
+
+const schema = `
+CREATE TABLE IF NOT EXISTS prices (
+	marketplace    TEXT    NOT NULL,
+	product_id     TEXT    NOT NULL,
+	discount_price INTEGER NOT NULL,
+	base_price     INTEGER NOT NULL,
+	recorded_at    INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS prices_product ON prices (marketplace, product_id, recorded_at);
+`
+
+// Point is the price of an offer observed by one search.
+type Point struct {
+	DiscountPriceKopecks int64     `json:"discount_price"`
+	BasePriceKopecks     int64     `json:"base_price"`
+	RecordedAt           time.Time `json:"recorded_at"`
+}
+
+// History is the price series of an offer. The statistics are computed over
+// the discount price.
+type History struct {
+	Marketplace     string  `json:"marketplace"`
+	ProductID       string  `json:"product_id"`
+	Points          []Point `json:"points"`
+	MinPriceKopecks int64   `json:"min_price"`
+	MaxPriceKopecks int64   `json:"max_price"`
+	AvgPriceKopecks int64   `json:"avg_price"`
+}
+
+// Store keeps every price seen by the search service in SQLite.
+type Store struct {
+	db *sql.DB
+}
+
+// Open opens the database at path, creating it if needed.
+func Open(path string) (*Store, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, fmt.Errorf("open price history: %w", err)
+	}
+	// SQLite allows a single writer; one connection avoids SQLITE_BUSY.
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("create price history schema: %w", err)
+	}
+	return &Store{db: db}, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Record stores the prices of products observed at the given time. Offers
+// without an ID or a price are skipped, as are repeated offers of one search.
+func (s *Store) Record(ctx context.Context, products []product.Product, at time.Time) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("record prices: %w", err)
+	}
+	defer tx.Rollback()
+
+	insert, err := tx.PrepareContext(ctx, `INSERT INTO prices (marketplace, product_id, discount_price, base_price, recorded_at) VALUES (?, ?, ?, ?, ?)`)
+	if err != nil {
+		return fmt.Errorf("record prices: %w", err)
+	}
+	defer insert.Close()
+
+	seen := make(map[string]bool, len(products))
+	for _, p := range products {
+		key := product.Key(p.Marketplace, p.ProductID)
+		if p.Marketplace == "" || p.ProductID == "" || p.DiscountPriceKopecks <= 0 || seen[key] {
+			continue
+		}
+		seen[key] = true
+		if _, err := insert.ExecContext(ctx, p.Marketplace, p.ProductID, p.DiscountPriceKopecks, p.BasePriceKopecks, at.UnixMilli()); err != nil {
+			return fmt.Errorf("record price of %s: %w", key, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("record prices: %w", err)
+	}
+	return nil
+}
+
+// History returns the prices of an offer recorded since the given time,
+// oldest first.
+func (s *Store) History(ctx context.Context, marketplace, productID string, since time.Time) (History, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT discount_price, base_price, recorded_at FROM prices
+		WHERE marketplace = ? AND product_id = ? AND recorded_at >= ?
+		ORDER BY recorded_at`, marketplace, productID, since.UnixMilli())
+	if err != nil {
+		return History{}, fmt.Errorf("read price history: %w", err)
+	}
+	defer rows.Close()
+
+	h := History{Marketplace: marketplace, ProductID: productID}
+	var total int64
+	for rows.Next() {
+		var (
+			point      Point
+			recordedAt int64
+		)
+		if err := rows.Scan(&point.DiscountPriceKopecks, &point.BasePriceKopecks, &recordedAt); err != nil {
+			return History{}, fmt.Errorf("read price history: %w", err)
+		}
+		point.RecordedAt = time.UnixMilli(recordedAt).UTC()
+		if len(h.Points) == 0 || point.DiscountPriceKopecks < h.MinPriceKopecks {
+			h.MinPriceKopecks = point.DiscountPriceKopecks
+		}
+		h.MaxPriceKopecks = max(h.MaxPriceKopecks, point.DiscountPriceKopecks)
+		total += point.DiscountPriceKopecks
+		h.Points = append(h.Points, point)
+	}
+	if err := rows.Err(); err != nil {
+		return History{}, fmt.Errorf("read price history: %w", err)
+	}
+	if len(h.Points) == 0 {
+		return History{}, ErrNotFound
+	}
+	h.AvgPriceKopecks = (total + int64(len(h.Points))/2) / int64(len(h.Points))
+	return h, nil
+}
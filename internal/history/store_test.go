@@ -0,0 +1,143 @@
+package history
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"agregator/internal/product"
+)
+
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+	store, err := Open(filepath.Join(t.TempDir(), "history.db"))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	return store
+}
+
+func TestStoreHistory(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	for i, price := range []int64{1_000, 1_500, 800} {
+		products := []product.Product{
+			{Marketplace: "wb", ProductID: "42", DiscountPriceKopecks: price, BasePriceKopecks: 2_000},
+			{Marketplace: "wb", ProductID: "42", DiscountPriceKopecks: price, BasePriceKopecks: 2_000},
+			{Marketplace: "ozon", ProductID: "42", DiscountPriceKopecks: 5_000},
+			{Marketplace: "wb", ProductID: "", DiscountPriceKopecks: 100},
+		}
+		if err := store.Record(ctx, products, start.Add(time.Duration(i)*time.Hour)); err != nil {
+			t.Fatalf("Record() error = %v", err)
+		}
+	}
+
+	got, err := store.History(ctx, "wb", "42", start)
+	if err != nil {
+		t.Fatalf("History() error = %v", err)
+	}
+	if len(got.Points) != 3 {
+		t.Fatalf("History() points = %#v", got.Points)
+	}
+	if first := got.Points[0]; first.DiscountPriceKopecks != 1_000 || first.BasePriceKopecks != 2_000 || !first.RecordedAt.Equal(start) {
+		t.Fatalf("first point = %#v", first)
+	}
+	if got.MinPriceKopecks != 800 || got.MaxPriceKopecks != 1_500 || got.AvgPriceKopecks != 1_100 {
+		t.Fatalf("History() stats = %d/%d/%d", got.MinPriceKopecks, got.MaxPriceKopecks, got.AvgPriceKopecks)
+	}
+
+	recent, err := store.History(ctx, "wb", "42", start.Add(90*time.Minute))
+	if err != nil || len(recent.Points) != 1 || recent.MinPriceKopecks != 800 {
+		t.Fatalf("History() since = %#v, %v", recent, err)
+	}
+	if _, err := store.History(ctx, "wb", "missing", start); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("History() error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestStoreCheckPrices(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	record := func(id string, prices ...int64) {
+		for i, price := range prices {
+			at := now.Add(-time.Duration(len(prices)-i) * 24 * time.Hour)
+			if err := store.Record(ctx, []product.Product{{Marketplace: "wb", ProductID: id, DiscountPriceKopecks: price}}, at); err != nil {
+				t.Fatalf("Record() error = %v", err)
+			}
+		}
+	}
+	record("real", 2_000, 2_100, 1_900)
+	record("fake", 1_000, 1_000, 1_050)
+	record("regular", 1_900, 2_000, 1_950)
+	record("new", 1_000)
+	if err := store.Record(ctx, []product.Product{{Marketplace: "wb", ProductID: "fake", DiscountPriceKopecks: 500}}, now.Add(-40*24*time.Hour)); err != nil {
+		t.Fatalf("Record() error = %v", err)
+	}
+	if err := store.Record(ctx, []product.Product{{Marketplace: "wb", ProductID: "real", DiscountPriceKopecks: 100}}, now); err != nil {
+		t.Fatalf("Record() error = %v", err)
+	}
+
+	products := []product.Product{
+		{Marketplace: "wb", ProductID: "real", DiscountPriceKopecks: 1_500, BasePriceKopecks: 2_000},
+		{Marketplace: "wb", ProductID: "fake", DiscountPriceKopecks: 1_000, BasePriceKopecks: 3_000},
+		{Marketplace: "wb", ProductID: "regular", DiscountPriceKopecks: 1_950, BasePriceKopecks: 2_000},
+		{Marketplace: "wb", ProductID: "new", DiscountPriceKopecks: 500, BasePriceKopecks: 2_000},
+	}
+	checks, err := store.CheckPrices(ctx, products, now)
+	if err != nil {
+		t.Fatalf("CheckPrices() error = %v", err)
+	}
+	want := map[string]product.PriceCheck{
+		"wb:real":    {Verdict: product.VerdictReal, MedianPriceKopecks: 2_000, Observations: 3, BelowMedian: true, BasePriceCharged: true},
+		"wb:fake":    {Verdict: product.VerdictFake, MedianPriceKopecks: 1_000, Observations: 3},
+		"wb:regular": {Verdict: product.VerdictRegular, MedianPriceKopecks: 1_950, Observations: 3, BasePriceCharged: true},
+		"wb:new":     {Verdict: product.VerdictUnknown, Observations: 1},
+	}
+	for key, check := range want {
+		if checks[key] != check {
+			t.Fatalf("%s: check = %#v, want %#v", key, checks[key], check)
+		}
+	}
+}
+
+func TestStoreCheckPricesInBatches(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	products := make([]product.Product, checkBatch+10)
+	for i := range products {
+		products[i] = product.Product{Marketplace: "wb", ProductID: fmt.Sprint(i), DiscountPriceKopecks: 1_000}
+	}
+	for day := 1; day <= minObservations; day++ {
+		recorded := slices.Clone(products)
+		for i := range recorded {
+			recorded[i].DiscountPriceKopecks = 2_000
+		}
+		if err := store.Record(ctx, recorded, now.Add(-time.Duration(day)*24*time.Hour)); err != nil {
+			t.Fatalf("Record() error = %v", err)
+		}
+	}
+
+	checks, err := store.CheckPrices(ctx, products, now)
+	if err != nil {
+		t.Fatalf("CheckPrices() error = %v", err)
+	}
+	if len(checks) != len(products) {
+		t.Fatalf("CheckPrices() returned %d checks, want %d", len(checks), len(products))
+	}
+	for _, i := range []int{0, checkBatch - 1, checkBatch, len(products) - 1} {
+		if check := checks[product.Key("wb", fmt.Sprint(i))]; check.Verdict != product.VerdictReal || check.Observations != minObservations {
+			t.Fatalf("product %d: check = %#v", i, check)
+		}
+	}
+}
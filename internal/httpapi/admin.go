@@ -0,0 +1,178 @@
+package httpapi
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+
+	"agregator/internal/cache"
+	"agregator/internal/search"
+)
+
+const (
+	defaultListLimit   = 100
+	maxListLimit       = 1000
+	maxWarmQueries     = 500
+	maxWarmConcurrency = 4
+	keptWarmJobs       = 20
+)
+
+// Admin serves the cache administration endpoints. Every request must carry
+// the token in an "Authorization: Bearer" header.
+type Admin struct {
+	token  string
+	cache  cache.Admin
+	search *search.Service
+	logger *slog.Logger
+
+	mu    sync.Mutex
+	jobs  map[string]*search.WarmJob
+	order []string
+}
+
+func NewAdmin(logger *slog.Logger, token string, cacheAdmin cache.Admin, searchService *search.Service) *Admin {
+	return &Admin{
+		logger: logger,
+		token:  token,
+		cache:  cacheAdmin,
+		search: searchService,
+		jobs:   make(map[string]*search.WarmJob),
+	}
+}
+
+func (a *Admin) Register(mux *http.ServeMux) {
+	mux.Handle("GET /admin/cache", authorize(a.logger, a.token, a.List))
+	mux.Handle("DELETE /admin/cache", authorize(a.logger, a.token, a.Purge))
+	mux.Handle("POST /admin/cache/warm", authorize(a.logger, a.token, a.Warm))
+	mux.Handle("GET /admin/cache/warm/{id}", authorize(a.logger, a.token, a.WarmStatus))
+}
+
+// authorize lets through only requests with the token in an
+// "Authorization: Bearer" header.
+func authorize(logger *slog.Logger, token string, next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			logger.Warn("unauthorized request", "path", r.URL.Path, "remote", r.RemoteAddr)
+			writeError(w, r, http.StatusUnauthorized, CodeUnauthorized, "admin token required")
+			return
+		}
+		next(w, r)
+	})
+}
+
+// List returns cached queries starting with the prefix parameter.
+func (a *Admin) List(w http.ResponseWriter, r *http.Request) {
+	limit, err := parseInt(r.URL.Query(), "limit")
+	if err != nil || limit > maxListLimit {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidParameter, fmt.Sprintf("limit must be an integer from 0 to %d", maxListLimit))
+		return
+	}
+	if limit == 0 {
+		limit = defaultListLimit
+	}
+	infos, err := a.cache.List(r.Context(), strings.ToLower(r.URL.Query().Get("prefix")), int(limit))
+	if err != nil {
+		a.logger.Error("list cache", "error", err)
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "list cache failed")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"queries": infos, "count": len(infos)})
+}
+
+// Purge deletes one query, every query with a prefix or, with all=true, the
+// whole cache.
+func (a *Admin) Purge(w http.ResponseWriter, r *http.Request) {
+	values := r.URL.Query()
+	var (
+		deleted int
+		err     error
+	)
+	switch {
+	case values.Get("query") != "" && !values.Has("prefix") && !values.Has("all"):
+		deleted, err = a.cache.Delete(r.Context(), search.NormalizeQuery(values.Get("query")))
+	case values.Get("prefix") != "" && !values.Has("query") && !values.Has("all"):
+		deleted, err = a.cache.DeletePrefix(r.Context(), strings.ToLower(values.Get("prefix")))
+	case values.Get("all") == "true" && !values.Has("query") && !values.Has("prefix"):
+		deleted, err = a.cache.DeletePrefix(r.Context(), "")
+	default:
+		writeError(w, r, http.StatusBadRequest, CodeInvalidParameter, "exactly one of query, prefix or all=true is required")
+		return
+	}
+	if err != nil {
+		a.logger.Error("purge cache", "error", err)
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "purge cache failed")
+		return
+	}
+	a.logger.Info("cache purged", "query", values.Get("query"), "prefix", values.Get("prefix"), "all", values.Get("all"), "deleted", deleted)
+	writeJSON(w, http.StatusOK, map[string]int{"deleted": deleted})
+}
+
+type warmRequest struct {
+	Queries     []string `json:"queries"`
+	Concurrency int      `json:"concurrency"`
+}
+
+type warmResponse struct {
+	ID string `json:"id"`
+	search.WarmProgress
+}
+
+// Warm starts fetching the queries of the request body in the background and
+// answers with the job ID.
+func (a *Admin) Warm(w http.ResponseWriter, r *http.Request) {
+	var request warmRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&request); err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidParameter, "body must be JSON with a queries array")
+		return
+	}
+	queries := make([]string, 0, len(request.Queries))
+	for _, query := range request.Queries {
+		if query = search.NormalizeQuery(query); query != "" {
+			queries = append(queries, query)
+		}
+	}
+	if len(queries) == 0 || len(queries) > maxWarmQueries {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidParameter, fmt.Sprintf("queries must contain from 1 to %d queries", maxWarmQueries))
+		return
+	}
+	concurrency := min(max(request.Concurrency, 1), maxWarmConcurrency)
+
+	job := a.search.Warm(context.Background(), queries, concurrency)
+	id := newRequestID()
+	a.mu.Lock()
+	a.jobs[id] = job
+	a.order = append(a.order, id)
+	if len(a.order) > keptWarmJobs {
+		delete(a.jobs, a.order[0])
+		a.order = a.order[1:]
+	}
+	a.mu.Unlock()
+
+	a.logger.Info("cache warm started", "job", id, "queries", len(queries), "concurrency", concurrency)
+	w.Header().Set("Location", "/admin/cache/warm/"+id)
+	writeJSON(w, http.StatusAccepted, warmResponse{ID: id, WarmProgress: job.Progress()})
+}
+
+func (a *Admin) WarmStatus(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	a.mu.Lock()
+	job, ok := a.jobs[id]
+	a.mu.Unlock()
+	if !ok {
+		writeError(w, r, http.StatusNotFound, CodeNotFound, "warm job not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, warmResponse{ID: id, WarmProgress: job.Progress()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
@@ -0,0 +1,134 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"agregator/internal/cache"
+	"agregator/internal/product"
+	"agregator/internal/search"
+)
+
+func newAdmin(t *testing.T) (*http.ServeMux, *cache.Memory, *search.Service) {
+	t.Helper()
+	memory := cache.NewMemory(10)
+	service := search.New(slog.Default(), memory, fakeMarketplace{name: "wb", products: []product.Product{{Key: "wb:1", Marketplace: "wb", DiscountPriceKopecks: 100}}})
+	mux := http.NewServeMux()
+	NewAdmin(slog.Default(), "secret", memory, service).Register(mux)
+	return mux, memory, service
+}
+
+func adminRequest(mux *http.ServeMux, method, target, body string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, target, strings.NewReader(body))
+	request.Header.Set("Authorization", "Bearer secret")
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestAdminRequiresToken(t *testing.T) {
+	mux, _, _ := newAdmin(t)
+	for _, header := range []string{"", "Bearer wrong", "secret"} {
+		request := httptest.NewRequest(http.MethodGet, "/admin/cache", nil)
+		if header != "" {
+			request.Header.Set("Authorization", header)
+		}
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, request)
+		if recorder.Code != http.StatusUnauthorized {
+			t.Fatalf("%q: status = %d, want %d", header, recorder.Code, http.StatusUnauthorized)
+		}
+		if response := decodeError(t, recorder); response.Code != CodeUnauthorized {
+			t.Fatalf("%q: code = %q", header, response.Code)
+		}
+	}
+}
+
+func TestAdminListsAndPurgesCache(t *testing.T) {
+	mux, memory, service := newAdmin(t)
+	for _, query := range []string{"iPhone 15", "iphone 15 pro", "tv"} {
+		if _, err := service.Search(context.Background(), query, search.Options{}); err != nil {
+			t.Fatalf("Search() error = %v", err)
+		}
+	}
+
+	recorder := adminRequest(mux, http.MethodGet, "/admin/cache?prefix=IPHONE", "")
+	var list struct {
+		Queries []cache.Info `json:"queries"`
+		Count   int          `json:"count"`
+	}
+	if err := json.NewDecoder(recorder.Body).Decode(&list); err != nil {
+		t.Fatalf("decode list: %v", err)
+	}
+	if list.Count != 2 || list.Queries[0].Query != "iphone 15" || list.Queries[0].Products != 1 {
+		t.Fatalf("list = %#v", list)
+	}
+
+	// Each purge leaves one entry for the next.
+	for _, target := range []string{
+		"/admin/cache?query=iPhone%2015",
+		"/admin/cache?prefix=iphone",
+		"/admin/cache?all=true",
+	} {
+		recorder := adminRequest(mux, http.MethodDelete, target, "")
+		var response struct{ Deleted int }
+		if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil || response.Deleted != 1 {
+			t.Fatalf("%s: deleted = %d, %v, want 1", target, response.Deleted, err)
+		}
+	}
+	if memory.Len() != 0 {
+		t.Fatalf("memory = %d entries after purge", memory.Len())
+	}
+
+	for _, target := range []string{"/admin/cache", "/admin/cache?query=tv&all=true", "/admin/cache?all=yes"} {
+		if recorder := adminRequest(mux, http.MethodDelete, target, ""); recorder.Code != http.StatusBadRequest {
+			t.Fatalf("%s: status = %d, want %d", target, recorder.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestAdminWarmsQueries(t *testing.T) {
+	mux, memory, _ := newAdmin(t)
+
+	recorder := adminRequest(mux, http.MethodPost, "/admin/cache/warm", `{"queries": ["Phone", "tv", " "], "concurrency": 10}`)
+	if recorder.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want %d: %s", recorder.Code, http.StatusAccepted, recorder.Body)
+	}
+	var started warmResponse
+	if err := json.NewDecoder(recorder.Body).Decode(&started); err != nil {
+		t.Fatalf("decode warm response: %v", err)
+	}
+	if started.ID == "" || started.Total != 2 || recorder.Header().Get("Location") != "/admin/cache/warm/"+started.ID {
+		t.Fatalf("warm response = %#v", started)
+	}
+
+	var progress warmResponse
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		recorder := adminRequest(mux, http.MethodGet, "/admin/cache/warm/"+started.ID, "")
+		if err := json.NewDecoder(recorder.Body).Decode(&progress); err != nil {
+			t.Fatalf("decode progress: %v", err)
+		}
+		if !progress.Running {
+			break
+		}
+	}
+	if progress.Running || progress.Done != 2 || progress.Failed != 0 || progress.FinishedAt == nil {
+		t.Fatalf("progress = %#v", progress)
+	}
+	if memory.Len() != 2 {
+		t.Fatalf("memory = %d entries, want 2", memory.Len())
+	}
+
+	if recorder := adminRequest(mux, http.MethodGet, "/admin/cache/warm/unknown", ""); recorder.Code != http.StatusNotFound {
+		t.Fatalf("unknown job status = %d", recorder.Code)
+	}
+	if recorder := adminRequest(mux, http.MethodPost, "/admin/cache/warm", `{"queries": []}`); recorder.Code != http.StatusBadRequest {
+		t.Fatalf("empty warm status = %d", recorder.Code)
+	}
+}
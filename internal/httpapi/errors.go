@@ -0,0 +1,89 @@
+package httpapi
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"agregator/internal/search"
+)
+
+// Error codes are part of the API: clients branch on them, so they must not
+// change when messages do.
+const (
+	CodeQueryRequired    = "query_required"
+	CodeInvalidParameter = "invalid_parameter"
+	CodeNotFound         = "not_found"
+	CodeAllSourcesFailed = "all_sources_failed"
+	CodeTimeout          = "timeout"
+	CodeRateLimited      = "rate_limited"
+	CodeUnauthorized     = "unauthorized"
+	CodeInternal         = "internal"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+type errorResponse struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	RequestID string `json:"request_id"`
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	id := RequestIDFrom(r.Context())
+	if id == "" {
+		id = newRequestID()
+		w.Header().Set(requestIDHeader, id)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(errorResponse{Code: code, Message: message, RequestID: id})
+}
+
+// writeSearchError maps the error of a search to a status and a code. Upstream
+// error texts are logged but never returned.
+func writeSearchError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, search.ErrProductsNotFound):
+		writeError(w, r, http.StatusNotFound, CodeNotFound, "products not found")
+	case errors.Is(err, context.DeadlineExceeded):
+		writeError(w, r, http.StatusGatewayTimeout, CodeTimeout, "marketplaces did not answer in time")
+	case errors.Is(err, search.ErrRateLimited):
+		w.Header().Set("Retry-After", "60")
+		writeError(w, r, http.StatusServiceUnavailable, CodeRateLimited, "marketplaces are limiting requests, try again later")
+	case errors.Is(err, search.ErrAllSourcesFailed):
+		writeError(w, r, http.StatusBadGateway, CodeAllSourcesFailed, "all marketplaces failed")
+	default:
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "search failed")
+	}
+}
+
+type requestIDKey struct{}
+
+// RequestID takes the request ID from the X-Request-ID header or generates one,
+// stores it in the request context and echoes it in the response.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if id == "" || len(id) > 64 {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+// RequestIDFrom returns the ID stored by RequestID, or an empty string.
+func RequestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -4,13 +4,25 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
+	"agregator/internal/match"
+	"agregator/internal/product"
 	"agregator/internal/search"
 )
 
+const (
+	defaultPageLimit = 30
+	maxPageLimit     = 100
+)
+
 type Handler struct {
 	search  *search.Service
 	timeout time.Duration
@@ -22,30 +34,227 @@ func New(logger *slog.Logger, searchService *search.Service, timeout time.Durati
 }
 
 func (h *Handler) Search(w http.ResponseWriter, r *http.Request) {
-	query := r.URL.Query().Get("query")
-	if query == "" {
-		h.logger.Warn("request without query")
-		http.Error(w, "query parameter is required", http.StatusBadRequest)
+	query, options, ok := h.parseSearch(w, r)
+	if !ok {
+		return
+	}
+
+	pages, err := parsePagination(r.URL.Query())
+	if err != nil {
+		h.logger.Warn("invalid pagination", "query", query, "error", err)
+		writeError(w, r, http.StatusBadRequest, CodeInvalidParameter, err.Error())
 		return
 	}
 
 	ctx, cancel := context.WithTimeout(r.Context(), h.timeout)
 	defer cancel()
 
-	products, err := h.search.Search(ctx, query)
+	result, err := h.search.Search(ctx, query, options)
 	if err != nil {
-		h.logger.Error("search failed", "query", query, "error", err)
-		if errors.Is(err, search.ErrProductsNotFound) {
-			http.Error(w, err.Error(), http.StatusNotFound)
-			return
-		}
-		http.Error(w, "search failed", http.StatusInternalServerError)
+		h.logger.Error("search failed", "query", query, "request_id", RequestIDFrom(r.Context()), "error", err)
+		writeSearchError(w, r, err)
+		return
+	}
+
+	var response any
+	legacy := r.URL.Query().Get("format") == "array"
+	if r.URL.Query().Get("group") == "true" {
+		response, err = groupResponse(result, pages, legacy)
+	} else {
+		response, err = productResponse(result, pages, legacy)
+	}
+	if err != nil {
+		h.logger.Warn("invalid cursor", "query", query, "error", err)
+		writeError(w, r, http.StatusBadRequest, CodeInvalidParameter, err.Error())
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(products); err != nil {
+	if err := json.NewEncoder(w).Encode(response); err != nil {
 		h.logger.Error("encode search response", "error", err)
-		http.Error(w, "encode response", http.StatusInternalServerError)
 	}
 }
+
+// parseSearch reads the parameters shared by /search and /search/stream and
+// answers with 400 Bad Request when they are invalid.
+func (h *Handler) parseSearch(w http.ResponseWriter, r *http.Request) (string, search.Options, bool) {
+	query := r.URL.Query().Get("query")
+	if query == "" {
+		h.logger.Warn("request without query")
+		writeError(w, r, http.StatusBadRequest, CodeQueryRequired, "query parameter is required")
+		return "", search.Options{}, false
+	}
+
+	filter, err := h.parseFilter(r.URL.Query())
+	if err != nil {
+		h.logger.Warn("invalid search filter", "query", query, "error", err)
+		writeError(w, r, http.StatusBadRequest, CodeInvalidParameter, err.Error())
+		return "", search.Options{}, false
+	}
+	order, err := search.ParseSortOrder(r.URL.Query().Get("sort"))
+	if err != nil {
+		h.logger.Warn("invalid sort order", "query", query, "error", err)
+		writeError(w, r, http.StatusBadRequest, CodeInvalidParameter, err.Error())
+		return "", search.Options{}, false
+	}
+	return query, search.Options{Filter: filter, Sort: order}, true
+}
+
+func (h *Handler) parseFilter(values url.Values) (search.Filter, error) {
+	var (
+		filter search.Filter
+		err    error
+	)
+	if filter.MinPriceKopecks, err = parseInt(values, "min_price"); err != nil {
+		return search.Filter{}, err
+	}
+	if filter.MaxPriceKopecks, err = parseInt(values, "max_price"); err != nil {
+		return search.Filter{}, err
+	}
+	if filter.MaxPriceKopecks > 0 && filter.MaxPriceKopecks < filter.MinPriceKopecks {
+		return search.Filter{}, errors.New("max_price must not be less than min_price")
+	}
+	if filter.MinReviews, err = parseInt(values, "min_reviews"); err != nil {
+		return search.Filter{}, err
+	}
+	if value := values.Get("min_rating"); value != "" {
+		filter.MinRating, err = strconv.ParseFloat(value, 64)
+		if err != nil || filter.MinRating < 0 || filter.MinRating > 5 {
+			return search.Filter{}, fmt.Errorf("min_rating must be a number from 0 to 5")
+		}
+	}
+	if value := values.Get("marketplaces"); value != "" {
+		known := h.search.Marketplaces()
+		for _, name := range strings.Split(value, ",") {
+			name = strings.ToLower(strings.TrimSpace(name))
+			if name == "" {
+				continue
+			}
+			if !slices.Contains(known, name) {
+				return search.Filter{}, fmt.Errorf("unknown marketplace %q", name)
+			}
+			filter.Marketplaces = append(filter.Marketplaces, name)
+		}
+	}
+	return filter, nil
+}
+
+type pagination struct {
+	enabled bool
+	limit   int
+	offset  int
+	cursor  string
+}
+
+// parsePagination reports whether the client asked for a page. Requests without
+// limit, offset and cursor receive the whole result.
+func parsePagination(values url.Values) (pagination, error) {
+	cursor := values.Get("cursor")
+	if !values.Has("limit") && !values.Has("offset") && cursor == "" {
+		return pagination{}, nil
+	}
+	limit, err := parseInt(values, "limit")
+	if err != nil {
+		return pagination{}, err
+	}
+	if limit == 0 {
+		limit = defaultPageLimit
+	}
+	if limit > maxPageLimit {
+		return pagination{}, fmt.Errorf("limit must not exceed %d", maxPageLimit)
+	}
+	offset, err := parseInt(values, "offset")
+	if err != nil {
+		return pagination{}, err
+	}
+	if offset > 0 && cursor != "" {
+		return pagination{}, errors.New("offset and cursor are mutually exclusive")
+	}
+	return pagination{enabled: true, limit: int(limit), offset: int(offset), cursor: cursor}, nil
+}
+
+// envelope describes the result in every /search response except the bare
+// arrays kept for clients that pass format=array.
+type envelope struct {
+	Total      int                   `json:"total"`
+	NextCursor string                `json:"next_cursor,omitempty"`
+	Sources    []search.SourceStatus `json:"sources"`
+	Partial    bool                  `json:"partial"`
+	Cached     bool                  `json:"cached"`
+	CachedAt   *time.Time            `json:"cached_at,omitempty"`
+	Stale      bool                  `json:"stale"`
+	AgeSeconds int64                 `json:"age_seconds"`
+}
+
+func newEnvelope(result search.Result, total int, next string) envelope {
+	return envelope{
+		Total:      total,
+		NextCursor: next,
+		Sources:    result.Sources,
+		Partial:    result.Partial,
+		Cached:     result.Cached,
+		CachedAt:   result.CachedAt,
+		Stale:      result.Stale,
+		AgeSeconds: result.AgeSeconds,
+	}
+}
+
+type productPage struct {
+	Products []product.Product `json:"products"`
+	envelope
+}
+
+type clusterPage struct {
+	Clusters []match.Cluster `json:"clusters"`
+	envelope
+}
+
+func productResponse(result search.Result, pages pagination, legacy bool) (any, error) {
+	if !pages.enabled {
+		if legacy {
+			return result.Products, nil
+		}
+		return productPage{Products: result.Products, envelope: newEnvelope(result, len(result.Products), "")}, nil
+	}
+	page, err := search.Paginate(result.Products, pages.limit, pages.offset, pages.cursor)
+	if err != nil {
+		return nil, err
+	}
+	return productPage{Products: page.Products, envelope: newEnvelope(result, page.Total, page.NextCursor)}, nil
+}
+
+// groupResponse merges offers of the same product from different marketplaces.
+// Pages are counted in clusters rather than in offers.
+func groupResponse(result search.Result, pages pagination, legacy bool) (any, error) {
+	clusters := match.Group(result.Products)
+	if clusters == nil {
+		clusters = []match.Cluster{}
+	}
+	if !pages.enabled {
+		if legacy {
+			return clusters, nil
+		}
+		return clusterPage{Clusters: clusters, envelope: newEnvelope(result, len(clusters), "")}, nil
+	}
+	keys := make([]string, len(clusters))
+	for i, c := range clusters {
+		keys[i] = c.Key + "|" + c.BestOffer.Key
+	}
+	start, end, next, err := search.Window(keys, pages.limit, pages.offset, pages.cursor)
+	if err != nil {
+		return nil, err
+	}
+	return clusterPage{Clusters: clusters[start:end], envelope: newEnvelope(result, len(clusters), next)}, nil
+}
+
+func parseInt(values url.Values, name string) (int64, error) {
+	value := values.Get(name)
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%s must be a non-negative integer", name)
+	}
+	return n, nil
+}
@@ -2,10 +2,13 @@ package httpapi
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -14,10 +17,15 @@ import (
 )
 
 type fakeMarketplace struct {
+	name     string
 	products []product.Product
 	err      error
 }
 
+func (m fakeMarketplace) Name() string {
+	return m.name
+}
+
 func (m fakeMarketplace) Search(_ context.Context, _ string) ([]product.Product, error) {
 	return m.products, m.err
 }
@@ -27,12 +35,33 @@ func newHandler(marketplace fakeMarketplace) *Handler {
 	return New(slog.Default(), service, time.Second)
 }
 
+func decodeError(t *testing.T, recorder *httptest.ResponseRecorder) errorResponse {
+	t.Helper()
+	var response errorResponse
+	if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+		t.Fatalf("decode error response: %v", err)
+	}
+	return response
+}
+
 func TestSearchRequiresQuery(t *testing.T) {
 	recorder := httptest.NewRecorder()
-	newHandler(fakeMarketplace{}).Search(recorder, httptest.NewRequest(http.MethodGet, "/search", nil))
+	request := httptest.NewRequest(http.MethodGet, "/search", nil)
+	request.Header.Set("X-Request-ID", "req-1")
+	RequestID(http.HandlerFunc(newHandler(fakeMarketplace{}).Search)).ServeHTTP(recorder, request)
 	if recorder.Code != http.StatusBadRequest {
 		t.Fatalf("status = %d, want %d", recorder.Code, http.StatusBadRequest)
 	}
+	if contentType := recorder.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Fatalf("Content-Type = %q", contentType)
+	}
+	response := decodeError(t, recorder)
+	if response.Code != CodeQueryRequired || response.RequestID != "req-1" || response.Message == "" {
+		t.Fatalf("error = %#v", response)
+	}
+	if id := recorder.Header().Get("X-Request-ID"); id != "req-1" {
+		t.Fatalf("X-Request-ID = %q", id)
+	}
 }
 
 func TestSearchReturnsProducts(t *testing.T) {
@@ -51,10 +80,174 @@ func TestSearchHidesInternalError(t *testing.T) {
 	recorder := httptest.NewRecorder()
 	handler := newHandler(fakeMarketplace{err: errors.New("upstream secret")})
 	handler.Search(recorder, httptest.NewRequest(http.MethodGet, "/search?query=phone", nil))
-	if recorder.Code != http.StatusInternalServerError {
-		t.Fatalf("status = %d, want %d", recorder.Code, http.StatusInternalServerError)
+	if recorder.Code != http.StatusBadGateway {
+		t.Fatalf("status = %d, want %d", recorder.Code, http.StatusBadGateway)
+	}
+	if strings.Contains(recorder.Body.String(), "upstream secret") {
+		t.Fatal("internal error leaked to response")
+	}
+	if response := decodeError(t, recorder); response.Code != CodeAllSourcesFailed || response.RequestID == "" {
+		t.Fatalf("error = %#v", response)
+	}
+}
+
+func TestSearchErrorCodes(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+	}{
+		{"not found", nil, http.StatusNotFound, CodeNotFound},
+		{"timeout", context.DeadlineExceeded, http.StatusGatewayTimeout, CodeTimeout},
+		{"rate limited", fmt.Errorf("status 429: %w", search.ErrRateLimited), http.StatusServiceUnavailable, CodeRateLimited},
+		{"bad response", search.ErrBadResponse, http.StatusBadGateway, CodeAllSourcesFailed},
+	}
+	for _, tt := range tests {
+		recorder := httptest.NewRecorder()
+		newHandler(fakeMarketplace{name: "wb", err: tt.err}).Search(recorder, httptest.NewRequest(http.MethodGet, "/search?query=phone", nil))
+		if recorder.Code != tt.status {
+			t.Fatalf("%s: status = %d, want %d", tt.name, recorder.Code, tt.status)
+		}
+		if response := decodeError(t, recorder); response.Code != tt.code {
+			t.Fatalf("%s: code = %q, want %q", tt.name, response.Code, tt.code)
+		}
+	}
+}
+
+func TestSearchAppliesFilters(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	handler := newHandler(fakeMarketplace{name: "wb", products: []product.Product{
+		{ProductID: "cheap", Marketplace: "wb", DiscountPriceKopecks: 1_000},
+		{ProductID: "expensive", Marketplace: "wb", DiscountPriceKopecks: 5_000},
+	}})
+	handler.Search(recorder, httptest.NewRequest(http.MethodGet, "/search?query=phone&min_price=2000&marketplaces=wb", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", recorder.Code, http.StatusOK)
+	}
+	var page productPage
+	if err := json.NewDecoder(recorder.Body).Decode(&page); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(page.Products) != 1 || page.Products[0].ProductID != "expensive" || page.Total != 1 {
+		t.Fatalf("page = %#v", page)
+	}
+}
+
+func TestSearchReportsPartialResult(t *testing.T) {
+	service := search.New(slog.Default(), nil,
+		fakeMarketplace{name: "wb", products: []product.Product{{Key: "wb:1", DiscountPriceKopecks: 1_000}}},
+		fakeMarketplace{name: "ozon", err: errors.New("upstream secret")},
+	)
+	recorder := httptest.NewRecorder()
+	New(slog.Default(), service, time.Second).Search(recorder, httptest.NewRequest(http.MethodGet, "/search?query=phone", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", recorder.Code, http.StatusOK)
 	}
-	if recorder.Body.String() == "upstream secret\n" {
+	if strings.Contains(recorder.Body.String(), "upstream secret") {
 		t.Fatal("internal error leaked to response")
 	}
+	var page productPage
+	if err := json.NewDecoder(recorder.Body).Decode(&page); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if !page.Partial || page.Cached || len(page.Sources) != 2 {
+		t.Fatalf("page = %#v", page)
+	}
+	if ozon := page.Sources[0]; ozon.Marketplace != "ozon" || ozon.Status != search.StatusError || ozon.Error != search.CodeUnavailable {
+		t.Fatalf("ozon status = %#v", ozon)
+	}
+}
+
+func TestSearchKeepsBareArrayFormat(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	handler := newHandler(fakeMarketplace{name: "wb", products: []product.Product{{Key: "wb:1", DiscountPriceKopecks: 1_000}}})
+	handler.Search(recorder, httptest.NewRequest(http.MethodGet, "/search?query=phone&format=array", nil))
+	var products []product.Product
+	if err := json.NewDecoder(recorder.Body).Decode(&products); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(products) != 1 || products[0].Key != "wb:1" {
+		t.Fatalf("products = %#v", products)
+	}
+}
+
+func TestSearchRejectsInvalidFilter(t *testing.T) {
+	for _, target := range []string{
+		"/search?query=phone&min_price=-1",
+		"/search?query=phone&min_price=500&max_price=100",
+		"/search?query=phone&min_rating=6",
+		"/search?query=phone&marketplaces=avito",
+		"/search?query=phone&sort=cheapest",
+		"/search?query=phone&limit=1000",
+	} {
+		recorder := httptest.NewRecorder()
+		newHandler(fakeMarketplace{name: "wb"}).Search(recorder, httptest.NewRequest(http.MethodGet, target, nil))
+		if recorder.Code != http.StatusBadRequest {
+			t.Fatalf("%s: status = %d, want %d", target, recorder.Code, http.StatusBadRequest)
+		}
+		if response := decodeError(t, recorder); response.Code != CodeInvalidParameter {
+			t.Fatalf("%s: code = %q, want %q", target, response.Code, CodeInvalidParameter)
+		}
+	}
+}
+
+func TestSearchReturnsPages(t *testing.T) {
+	handler := newHandler(fakeMarketplace{name: "wb", products: []product.Product{
+		{Key: "wb:1", DiscountPriceKopecks: 1_000},
+		{Key: "wb:2", DiscountPriceKopecks: 2_000},
+		{Key: "wb:3", DiscountPriceKopecks: 3_000},
+	}})
+
+	var keys []string
+	target := "/search?query=phone&limit=2"
+	for target != "" {
+		recorder := httptest.NewRecorder()
+		handler.Search(recorder, httptest.NewRequest(http.MethodGet, target, nil))
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d", recorder.Code, http.StatusOK)
+		}
+		var page productPage
+		if err := json.NewDecoder(recorder.Body).Decode(&page); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+		if page.Total != 3 {
+			t.Fatalf("total = %d, want 3", page.Total)
+		}
+		for _, p := range page.Products {
+			keys = append(keys, p.Key)
+		}
+		target = ""
+		if page.NextCursor != "" {
+			target = "/search?query=phone&limit=2&cursor=" + page.NextCursor
+		}
+	}
+	if len(keys) != 3 || keys[0] != "wb:1" || keys[2] != "wb:3" {
+		t.Fatalf("keys = %v", keys)
+	}
+
+	recorder := httptest.NewRecorder()
+	handler.Search(recorder, httptest.NewRequest(http.MethodGet, "/search?query=phone&cursor=broken", nil))
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d", recorder.Code, http.StatusBadRequest)
+	}
+}
+
+func TestSearchGroupsOffers(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	handler := newHandler(fakeMarketplace{name: "wb", products: []product.Product{
+		{Key: "wb:1", Marketplace: "wb", ProductName: "Apple iPhone 15 128GB", DiscountPriceKopecks: 2_000},
+		{Key: "ozon:1", Marketplace: "ozon", ProductName: "Смартфон Apple iPhone 15 128 ГБ", DiscountPriceKopecks: 1_000},
+	}})
+	handler.Search(recorder, httptest.NewRequest(http.MethodGet, "/search?query=iphone&group=true&limit=10", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", recorder.Code, http.StatusOK)
+	}
+	var page clusterPage
+	if err := json.NewDecoder(recorder.Body).Decode(&page); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if page.Total != 1 || len(page.Clusters[0].Offers) != 2 || page.Clusters[0].BestOffer.Key != "ozon:1" {
+		t.Fatalf("page = %#v", page)
+	}
 }
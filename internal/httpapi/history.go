@@ -0,0 +1,57 @@
+package httpapi
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"agregator/internal/history"
+)
+
+const (
+	defaultHistoryDays = 30
+	maxHistoryDays     = 365
+)
+
+// History serves the price history recorded by searches.
+type History struct {
+	store  *history.Store
+	logger *slog.Logger
+}
+
+func NewHistory(logger *slog.Logger, store *history.Store) *History {
+	return &History{logger: logger, store: store}
+}
+
+func (h *History) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /products/{marketplace}/{id}/history", h.History)
+}
+
+// History returns the prices of an offer for the last days parameter days.
+func (h *History) History(w http.ResponseWriter, r *http.Request) {
+	days, err := parseInt(r.URL.Query(), "days")
+	if err != nil || days > maxHistoryDays {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidParameter, fmt.Sprintf("days must be an integer from 1 to %d", maxHistoryDays))
+		return
+	}
+	if days == 0 {
+		days = defaultHistoryDays
+	}
+	since := time.Now().AddDate(0, 0, -int(days))
+
+	marketplace := strings.ToLower(r.PathValue("marketplace"))
+	result, err := h.store.History(r.Context(), marketplace, r.PathValue("id"), since)
+	if errors.Is(err, history.ErrNotFound) {
+		writeError(w, r, http.StatusNotFound, CodeNotFound, "price history not found")
+		return
+	}
+	if err != nil {
+		h.logger.Error("read price history", "marketplace", marketplace, "id", r.PathValue("id"), "error", err)
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "read price history failed")
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
@@ -0,0 +1,60 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"agregator/internal/history"
+	"agregator/internal/product"
+)
+
+func TestHistory(t *testing.T) {
+	store, err := history.Open(filepath.Join(t.TempDir(), "history.db"))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer store.Close()
+	now := time.Now()
+	for i, price := range []int64{1_000, 3_000} {
+		products := []product.Product{{Marketplace: "wb", ProductID: "42", DiscountPriceKopecks: price, BasePriceKopecks: 5_000}}
+		if err := store.Record(context.Background(), products, now.Add(time.Duration(i-1)*time.Hour)); err != nil {
+			t.Fatalf("Record() error = %v", err)
+		}
+	}
+	if err := store.Record(context.Background(), []product.Product{{Marketplace: "wb", ProductID: "42", DiscountPriceKopecks: 100}}, now.AddDate(0, 0, -40)); err != nil {
+		t.Fatalf("Record() error = %v", err)
+	}
+	mux := http.NewServeMux()
+	NewHistory(slog.Default(), store).Register(mux)
+
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/products/WB/42/history", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", recorder.Code, recorder.Body)
+	}
+	var response history.History
+	if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(response.Points) != 2 || response.MinPriceKopecks != 1_000 || response.MaxPriceKopecks != 3_000 || response.AvgPriceKopecks != 2_000 {
+		t.Fatalf("response = %#v", response)
+	}
+
+	for target, want := range map[string]int{
+		"/products/wb/42/history?days=60":  http.StatusOK,
+		"/products/wb/42/history?days=400": http.StatusBadRequest,
+		"/products/wb/7/history":           http.StatusNotFound,
+	} {
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, target, nil))
+		if recorder.Code != want {
+			t.Fatalf("%s: status = %d, want %d", target, recorder.Code, want)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package httpapi
+
+import (
+	"net/http"
+)
+
+// Marketplace is an enabled marketplace as listed by GET /marketplaces.
+type Marketplace struct {
+	Name  string `json:"name"`
+	Label string `json:"label"`
+}
+
+// Marketplaces lists the marketplaces searched by the server so clients do
+// not have to hardcode them.
+type Marketplaces struct {
+	list []Marketplace
+}
+
+func NewMarketplaces(list []Marketplace) *Marketplaces {
+	return &Marketplaces{list: list}
+}
+
+func (m *Marketplaces) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /marketplaces", m.List)
+}
+
+func (m *Marketplaces) List(w http.ResponseWriter, r *http.Request) {
+	list := m.list
+	if list == nil {
+		list = []Marketplace{}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"marketplaces": list})
+}
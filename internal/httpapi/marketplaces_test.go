@@ -0,0 +1,30 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestMarketplaces(t *testing.T) {
+	list := []Marketplace{{Name: "wb", Label: "Wildberries"}, {Name: "ozon", Label: "Ozon"}}
+	mux := http.NewServeMux()
+	NewMarketplaces(list).Register(mux)
+
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/marketplaces", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", recorder.Code, recorder.Body)
+	}
+	var response struct {
+		Marketplaces []Marketplace `json:"marketplaces"`
+	}
+	if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if !slices.Equal(response.Marketplaces, list) {
+		t.Fatalf("marketplaces = %#v, want %#v", response.Marketplaces, list)
+	}
+}
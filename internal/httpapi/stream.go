@@ -0,0 +1,70 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"agregator/internal/search"
+)
+
+// Stream serves /search/stream as Server-Sent Events: a "batch" event with the
+// products of each marketplace as soon as it answers, a "status" event per
+// marketplace and a final "summary" event.
+func (h *Handler) Stream(w http.ResponseWriter, r *http.Request) {
+	query, options, ok := h.parseSearch(w, r)
+	if !ok {
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		h.logger.Error("response writer does not support streaming")
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "streaming unsupported")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), h.timeout)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	events := &eventWriter{w: w, flusher: flusher}
+	if err := h.search.Stream(ctx, query, options, events); err != nil {
+		h.logger.Warn("search stream finished with error", "query", query, "error", err)
+	}
+}
+
+type eventWriter struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+}
+
+func (e *eventWriter) Batch(batch search.Batch) error {
+	return e.send("batch", batch)
+}
+
+func (e *eventWriter) Status(status search.SourceStatus) error {
+	return e.send("status", status)
+}
+
+func (e *eventWriter) Summary(summary search.Summary) error {
+	return e.send("summary", summary)
+}
+
+func (e *eventWriter) send(event string, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("encode %s event: %w", event, err)
+	}
+	if _, err := fmt.Fprintf(e.w, "event: %s\ndata: %s\n\n", event, data); err != nil {
+		return err
+	}
+	e.flusher.Flush()
+	return nil
+}
@@ -0,0 +1,38 @@
+package httpapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"agregator/internal/product"
+)
+
+func TestStreamSendsEvents(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	handler := newHandler(fakeMarketplace{name: "wb", products: []product.Product{{Key: "wb:42", Marketplace: "wb", DiscountPriceKopecks: 1_000}}})
+	handler.Stream(recorder, httptest.NewRequest(http.MethodGet, "/search/stream?query=phone", nil))
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", recorder.Code, http.StatusOK)
+	}
+	if contentType := recorder.Header().Get("Content-Type"); contentType != "text/event-stream" {
+		t.Fatalf("Content-Type = %q", contentType)
+	}
+	body := recorder.Body.String()
+	batch := strings.Index(body, "event: batch\ndata: {\"marketplace\":\"wb\"")
+	status := strings.Index(body, "event: status\ndata: {\"marketplace\":\"wb\",\"status\":\"ok\",\"count\":1,")
+	summary := strings.Index(body, "event: summary\ndata: {\"total\":1")
+	if batch == -1 || status < batch || summary < status {
+		t.Fatalf("unexpected stream:\n%s", body)
+	}
+}
+
+func TestStreamRequiresQuery(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	newHandler(fakeMarketplace{}).Stream(recorder, httptest.NewRequest(http.MethodGet, "/search/stream", nil))
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d", recorder.Code, http.StatusBadRequest)
+	}
+}
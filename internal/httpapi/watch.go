@@ -0,0 +1,81 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"agregator/internal/watch"
+)
+
+// Watches manages price-drop subscriptions. The API is meant for trusted
+// front-ends such as bots, which pass their user as the owner, so it requires
+// the admin token.
+type Watches struct {
+	token  string
+	store  *watch.Store
+	logger *slog.Logger
+}
+
+func NewWatches(logger *slog.Logger, token string, store *watch.Store) *Watches {
+	return &Watches{logger: logger, token: token, store: store}
+}
+
+func (h *Watches) Register(mux *http.ServeMux) {
+	mux.Handle("POST /watches", authorize(h.logger, h.token, h.Add))
+	mux.Handle("GET /watches", authorize(h.logger, h.token, h.List))
+	mux.Handle("DELETE /watches/{id}", authorize(h.logger, h.token, h.Delete))
+}
+
+func (h *Watches) Add(w http.ResponseWriter, r *http.Request) {
+	var sub watch.Subscription
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&sub); err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidParameter, "body must be a JSON subscription")
+		return
+	}
+	sub, err := h.store.Add(r.Context(), sub)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidParameter, err.Error())
+		return
+	}
+	h.logger.Info("subscription added", "id", sub.ID, "owner", sub.Owner, "query", sub.Query)
+	writeJSON(w, http.StatusCreated, sub)
+}
+
+// List returns the subscriptions of the owner parameter.
+func (h *Watches) List(w http.ResponseWriter, r *http.Request) {
+	owner := r.URL.Query().Get("owner")
+	if owner == "" {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidParameter, "owner parameter is required")
+		return
+	}
+	subs, err := h.store.List(r.Context(), owner)
+	if err != nil {
+		h.logger.Error("list subscriptions", "error", err)
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "list subscriptions failed")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"subscriptions": subs, "count": len(subs)})
+}
+
+func (h *Watches) Delete(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	owner := r.URL.Query().Get("owner")
+	if err != nil || owner == "" {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidParameter, "numeric id and owner parameter are required")
+		return
+	}
+	err = h.store.Delete(r.Context(), owner, id)
+	if errors.Is(err, watch.ErrNotFound) {
+		writeError(w, r, http.StatusNotFound, CodeNotFound, "subscription not found")
+		return
+	}
+	if err != nil {
+		h.logger.Error("delete subscription", "id", id, "error", err)
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "delete subscription failed")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
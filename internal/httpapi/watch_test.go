@@ -0,0 +1,58 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"agregator/internal/watch"
+)
+
+func TestWatches(t *testing.T) {
+	store, err := watch.Open(filepath.Join(t.TempDir(), "watch.db"))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer store.Close()
+	mux := http.NewServeMux()
+	NewWatches(slog.Default(), "secret", store).Register(mux)
+
+	recorder := adminRequest(mux, http.MethodPost, "/watches", `{"owner": "alice", "query": "iPhone 15", "target_price": 5000000}`)
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("add status = %d: %s", recorder.Code, recorder.Body)
+	}
+	var added watch.Subscription
+	if err := json.NewDecoder(recorder.Body).Decode(&added); err != nil || added.ID == 0 || added.Query != "iphone 15" {
+		t.Fatalf("added = %#v, %v", added, err)
+	}
+	if recorder := adminRequest(mux, http.MethodPost, "/watches", `{"owner": "alice", "query": "tv"}`); recorder.Code != http.StatusBadRequest {
+		t.Fatalf("add without threshold status = %d", recorder.Code)
+	}
+
+	recorder = adminRequest(mux, http.MethodGet, "/watches?owner=alice", "")
+	var list struct {
+		Subscriptions []watch.Subscription `json:"subscriptions"`
+		Count         int                  `json:"count"`
+	}
+	if err := json.NewDecoder(recorder.Body).Decode(&list); err != nil || list.Count != 1 {
+		t.Fatalf("list = %#v, %v", list, err)
+	}
+
+	id := strconv.FormatInt(added.ID, 10)
+	for _, step := range []struct {
+		target string
+		want   int
+	}{
+		{target: "/watches/" + id + "?owner=bob", want: http.StatusNotFound},
+		{target: "/watches/" + id, want: http.StatusBadRequest},
+		{target: "/watches/" + id + "?owner=alice", want: http.StatusNoContent},
+		{target: "/watches/" + id + "?owner=alice", want: http.StatusNotFound},
+	} {
+		if recorder := adminRequest(mux, http.MethodDelete, step.target, ""); recorder.Code != step.want {
+			t.Fatalf("%s: status = %d, want %d", step.target, recorder.Code, step.want)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package marketplace
+
+import (
+	"fmt"
+	"net/http"
+
+	"agregator/internal/search"
+)
+
+// StatusError classifies the last unexpected HTTP status of a marketplace, so
+// that clients can tell throttling from an outage.
+func StatusError(status int) error {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusForbidden:
+		return fmt.Errorf("%w: status %d", search.ErrRateLimited, status)
+	case 0:
+		return search.ErrUnavailable
+	default:
+		return fmt.Errorf("%w: status %d", search.ErrUnavailable, status)
+	}
+}
+
+// BadResponse marks err as a failure to parse a marketplace response.
+func BadResponse(err error) error {
+	return fmt.Errorf("%w: %w", search.ErrBadResponse, err)
+}
@@ -0,0 +1,34 @@
+package marketplace
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"agregator/internal/search"
+)
+
+func TestStatusError(t *testing.T) {
+	tests := []struct {
+		status int
+		want   error
+	}{
+		{http.StatusTooManyRequests, search.ErrRateLimited},
+		{http.StatusForbidden, search.ErrRateLimited},
+		{http.StatusBadGateway, search.ErrUnavailable},
+		{0, search.ErrUnavailable},
+	}
+	for _, tt := range tests {
+		if err := StatusError(tt.status); !errors.Is(err, tt.want) {
+			t.Errorf("StatusError(%d) = %v, want %v", tt.status, err, tt.want)
+		}
+	}
+}
+
+func TestBadResponse(t *testing.T) {
+	cause := errors.New("items not found")
+	err := BadResponse(cause)
+	if !errors.Is(err, search.ErrBadResponse) || !errors.Is(err, cause) {
+		t.Fatalf("BadResponse() = %v", err)
+	}
+}
@@ -3,42 +3,149 @@ package ozon
 import (
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"html"
 	"io"
 	"log/slog"
 	"math/rand"
 	"net/http"
-	"net/http/cookiejar"
 	"net/url"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
+	"agregator/internal/marketplace"
 	"agregator/internal/product"
 
 	"github.com/tidwall/gjson"
 )
 
+const Name = "ozon"
+
+var Info = marketplace.Info{
+	Name:    Name,
+	Label:   "Ozon",
+	BaseURL: defaultSiteURL,
+	Timeout: 45 * time.Second,
+	Capabilities: []marketplace.Capability{
+		marketplace.CapabilitySearch,
+		marketplace.CapabilityRatings,
+		marketplace.CapabilityImages,
+	},
+}
+
+const (
+	defaultPages       = 1
+	concurrentRequests = 2
+	defaultAPIURL      = "https://api.ozon.ru"
+	defaultSiteURL     = "https://www.ozon.ru"
+)
+
 type Client struct {
-	logger *slog.Logger
+	logger      *slog.Logger
+	pages       int
+	apiURL      string
+	siteURL     string
+	httpConfig  marketplace.HTTPConfig
+	cookiesFile string
+	session     *marketplace.Session
+	// sleep pauses between requests; tests replace it to run without delays.
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+type Option func(*Client)
+
+// WithPages sets how many search result pages are requested per query.
+func WithPages(pages int) Option {
+	return func(c *Client) {
+		if pages > 0 {
+			c.pages = pages
+		}
+	}
+}
+
+// WithAPIURL replaces https://api.ozon.ru, the host of the composer API.
+func WithAPIURL(apiURL string) Option {
+	return func(c *Client) {
+		if apiURL != "" {
+			c.apiURL = strings.TrimRight(apiURL, "/")
+		}
+	}
+}
+
+// WithSiteURL replaces https://www.ozon.ru, which is requested to warm up the
+// session and sent as the origin of API requests.
+func WithSiteURL(siteURL string) Option {
+	return func(c *Client) {
+		if siteURL != "" {
+			c.siteURL = strings.TrimRight(siteURL, "/")
+		}
+	}
+}
+
+// WithHTTP configures the session the client keeps for all searches.
+func WithHTTP(config marketplace.HTTPConfig) Option {
+	return func(c *Client) {
+		c.httpConfig = config
+	}
+}
+
+// WithCookiesFile loads the session cookies from a JSON export of browser
+// cookies, which helps to pass the anti-bot protection.
+func WithCookiesFile(path string) Option {
+	return func(c *Client) {
+		c.cookiesFile = strings.TrimSpace(path)
+	}
+}
+
+func New(logger *slog.Logger, options ...Option) *Client {
+	c := &Client{
+		logger:  logger.With("marketplace", Name),
+		pages:   defaultPages,
+		apiURL:  defaultAPIURL,
+		siteURL: defaultSiteURL,
+		sleep:   wait,
+	}
+	for _, option := range options {
+		option(c)
+	}
+	c.session = marketplace.NewSession(c.httpConfig)
+	if c.cookiesFile == "" {
+		c.logger.Debug("starting without cookies")
+	} else if err := loadCookies(c.logger, c.session, c.cookiesFile, c.apiURL, c.siteURL); err != nil {
+		c.logger.Error("load Ozon cookies", "path", c.cookiesFile, "error", err)
+	}
+	return c
 }
 
-func New(logger *slog.Logger) *Client {
-	return &Client{logger: logger.With("marketplace", "ozon")}
+func (c *Client) Name() string {
+	return Name
 }
 
 func (c *Client) Search(ctx context.Context, query string) ([]product.Product, error) {
-	ozon, err := c.ozonResponse(ctx, query)
-	if err != nil {
-		return nil, fmt.Errorf("[OZON] json collection error:%w", err)
+	if err := c.session.WarmUp(ctx, c.warmUp); err != nil {
+		return nil, fmt.Errorf("[OZON] warmup: %w", err)
 	}
-	products, err := parseProducts(ozon)
+
+	products, pageErrs, err := marketplace.FetchPages(ctx, c.pages, concurrentRequests, func(ctx context.Context, page int) ([]product.Product, error) {
+		ozon, err := c.ozonResponse(ctx, query, page)
+		if err != nil {
+			return nil, fmt.Errorf("[OZON] json collection error:%w", err)
+		}
+		products, err := parseProducts(ozon)
+		if err != nil {
+			return nil, marketplace.BadResponse(err)
+		}
+		return products, nil
+	})
 	if err != nil {
 		return nil, err
 	}
-	c.logger.Info("parsed products", "count", len(products))
+	for _, err := range pageErrs {
+		c.logger.Warn("additional page failed", "error", err)
+	}
+	c.logger.Info("parsed products", "count", len(products), "pages", c.pages)
 	return products, nil
 }
 
@@ -76,7 +183,7 @@ func parseProducts(ozon []byte) ([]product.Product, error) {
 		textAtom := getMainStateText(item, "textAtom")
 		title := textAtom.Get("textAtom.text").String()
 		if link != "" && strings.HasPrefix(link, "/") {
-			link = "https://www.ozon.ru" + link
+			link = defaultSiteURL + link
 		}
 		priceV2State := getMainStateText(item, "priceV2")
 		priceV2 := priceV2State.Get("priceV2")
@@ -137,6 +244,8 @@ func parseProducts(ozon []byte) ([]product.Product, error) {
 		}
 
 		p := product.Product{
+			Marketplace:          Name,
+			Key:                  product.Key(Name, sku),
 			Link:                 link,
 			IMG:                  img,
 			ProductID:            sku,
@@ -158,7 +267,7 @@ func parseProducts(ozon []byte) ([]product.Product, error) {
 	return products, nil
 }
 
-func setHeaders(req *http.Request, referer string) {
+func setHeaders(req *http.Request, origin, referer string) {
 	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/119.0.0.0 Safari/537.36")
 	req.Header.Set("Accept", "application/json, text/plain, */*")
 	req.Header.Set("Accept-Language", "ru-RU,ru;q=0.9,en-US;q=0.8,en;q=0.7")
@@ -166,7 +275,7 @@ func setHeaders(req *http.Request, referer string) {
 	req.Header.Set("Sec-Fetch-Site", "same-site")
 	req.Header.Set("Sec-Fetch-Mode", "cors")
 	req.Header.Set("Sec-Fetch-Dest", "empty")
-	req.Header.Set("Origin", "https://www.ozon.ru")
+	req.Header.Set("Origin", origin)
 	if referer != "" {
 		req.Header.Set("Referer", referer)
 	}
@@ -178,13 +287,13 @@ func setHeaders(req *http.Request, referer string) {
 
 }
 
-func warmUp(ctx context.Context, client *http.Client) error {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://www.ozon.ru/", nil)
+func (c *Client) warmUp(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.siteURL+"/", nil)
 	if err != nil {
 		return err
 	}
-	setHeaders(req, "")
-	resp, err := client.Do(req)
+	setHeaders(req, c.siteURL, "")
+	resp, err := c.session.Do(req)
 	if err != nil {
 		return err
 	}
@@ -193,7 +302,7 @@ func warmUp(ctx context.Context, client *http.Client) error {
 	return nil
 }
 
-func loadCookies(logger *slog.Logger, jar *cookiejar.Jar, path string) error {
+func loadCookies(logger *slog.Logger, session *marketplace.Session, path, apiURL, siteURL string) error {
 	dat, err := os.ReadFile(path)
 	if err != nil {
 		return fmt.Errorf("read cookies file: %w", err)
@@ -212,8 +321,14 @@ func loadCookies(logger *slog.Logger, jar *cookiejar.Jar, path string) error {
 	if err := json.Unmarshal(dat, &items); err != nil {
 		return fmt.Errorf("decode cookies file: %w", err)
 	}
-	uApi, _ := url.Parse("https://api.ozon.ru/")
-	uWWW, _ := url.Parse("https://www.ozon.ru/")
+	uApi, err := url.Parse(apiURL + "/")
+	if err != nil {
+		return fmt.Errorf("parse API URL: %w", err)
+	}
+	uWWW, err := url.Parse(siteURL + "/")
+	if err != nil {
+		return fmt.Errorf("parse site URL: %w", err)
+	}
 	for _, c := range items {
 		ck := &http.Cookie{
 			Name:     c.Name,
@@ -238,62 +353,25 @@ func loadCookies(logger *slog.Logger, jar *cookiejar.Jar, path string) error {
 			ck.Expires = time.Unix(sec, 0)
 		}
 
-		jar.SetCookies(uApi, []*http.Cookie{ck})
-		jar.SetCookies(uWWW, []*http.Cookie{ck})
+		session.SetCookies(uApi, []*http.Cookie{ck})
+		session.SetCookies(uWWW, []*http.Cookie{ck})
 	}
 	logger.Debug("cookies loaded", "count", len(items))
 	return nil
 }
 
 // получение json
-func (c *Client) ozonResponse(ctx context.Context, query string) ([]byte, error) {
-	searchpath := "/search?text=" + url.QueryEscape(query) + "&sorting=price&page=1"
-	apiUrl := "https://api.ozon.ru/composer-api.bx/page/json/v2?url=" + url.QueryEscape(searchpath)
-	referer := "https://www.ozon.ru/search/?text=" + url.QueryEscape(query) // для warmup
-
-	jar, err := cookiejar.New(nil)
-	if err != nil {
-		return nil, fmt.Errorf("[OZON] cookiejar:%w", err)
-	}
-	cookiesFile := strings.TrimSpace(os.Getenv("OZON_COOKIES_FILE"))
-	if cookiesFile != "" {
-		if err := loadCookies(c.logger, jar, cookiesFile); err != nil {
-			return nil, fmt.Errorf("load Ozon cookies: %w", err)
-		}
-	} else {
-		c.logger.Debug("starting without cookies")
-	}
-
-	transport := http.DefaultTransport.(*http.Transport).Clone()
-	transport.Proxy = nil
-	proxyURLText := strings.TrimSpace(os.Getenv("PROXY_URL"))
-	if proxyURLText != "" {
-		proxyURL, err := url.Parse(proxyURLText)
-		if err != nil {
-			return nil, fmt.Errorf("parse PROXY_URL: %w", err)
-		}
-		transport.Proxy = http.ProxyURL(proxyURL)
-		c.logger.Info("using proxy from environment")
-	}
-
-	client := &http.Client{
-		Transport: transport,
-		Timeout:   15 * time.Second,
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			return http.ErrUseLastResponse
-		},
-		Jar: jar,
-	}
-
-	if err := warmUp(ctx, client); err != nil {
-		return nil, fmt.Errorf("[OZON] warmup: %w", err)
-	}
+func (c *Client) ozonResponse(ctx context.Context, query string, page int) ([]byte, error) {
+	searchpath := "/search?text=" + url.QueryEscape(query) + "&sorting=price&page=" + strconv.Itoa(page)
+	apiUrl := c.apiURL + "/composer-api.bx/page/json/v2?url=" + url.QueryEscape(searchpath)
+	referer := c.siteURL + "/search/?text=" + url.QueryEscape(query) // для warmup
 
 	current := apiUrl
+	var lastStatus int
 	for step := 0; step < 2; step++ {
-		c.logger.Debug("request attempt", "attempt", step+1, "url", current)
+		c.logger.Debug("request attempt", "page", page, "attempt", step+1, "url", current)
 		seconds := rand.Intn(8) + 3
-		if err := wait(ctx, time.Duration(seconds)*time.Second); err != nil {
+		if err := c.sleep(ctx, time.Duration(seconds)*time.Second); err != nil {
 			return nil, err
 		}
 		req, err := http.NewRequestWithContext(ctx, http.MethodGet, current, nil)
@@ -301,8 +379,8 @@ func (c *Client) ozonResponse(ctx context.Context, query string) ([]byte, error)
 			return nil, fmt.Errorf("[OZON] new request: %w", err)
 		}
 
-		setHeaders(req, referer)
-		resp, err := client.Do(req)
+		setHeaders(req, c.siteURL, referer)
+		resp, err := c.session.Do(req)
 		if err != nil {
 			return nil, fmt.Errorf("[OZON] sending request err: %w", err)
 		}
@@ -315,12 +393,12 @@ func (c *Client) ozonResponse(ctx context.Context, query string) ([]byte, error)
 				return nil, fmt.Errorf("[OZON] redirect without location")
 			}
 			if strings.HasPrefix(loc, "/") {
-				loc = "https://api.ozon.ru" + loc
+				loc = c.apiURL + loc
 			} else if strings.HasPrefix(loc, "composer-api") {
-				loc = "https://api.ozon.ru/" + loc
+				loc = c.apiURL + "/" + loc
 			}
 			current = loc
-			if err := wait(ctx, 2*time.Second); err != nil {
+			if err := c.sleep(ctx, 2*time.Second); err != nil {
 				return nil, err
 			}
 			continue
@@ -336,6 +414,10 @@ func (c *Client) ozonResponse(ctx context.Context, query string) ([]byte, error)
 			c.logger.Debug("request completed", "status", resp.StatusCode)
 			return body, nil
 		}
+		lastStatus = resp.StatusCode
+		if resp.StatusCode == http.StatusForbidden {
+			c.session.Expire()
+		}
 		c.logger.Warn("unexpected response status", "status", resp.StatusCode)
 		if len(body) > 0 {
 			s := string(body)
@@ -345,7 +427,7 @@ func (c *Client) ozonResponse(ctx context.Context, query string) ([]byte, error)
 			c.logger.Debug("response body", "body", s)
 		}
 	}
-	return nil, errors.New("[OZON]  не удалось получить данные")
+	return nil, fmt.Errorf("[OZON]  не удалось получить данные: %w", marketplace.StatusError(lastStatus))
 
 }
 
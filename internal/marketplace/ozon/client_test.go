@@ -1,15 +1,28 @@
 package ozon
 
-import "testing"
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
 
-func TestParseProducts(t *testing.T) {
-	body := []byte(`{
-        "widgetStates": {
-            "tileGridDesktop-1": "{\"items\":[{\"sku\":\"42\",\"action\":{\"link\":\"/product/42\"},\"tileImage\":{\"items\":[{\"image\":{\"link\":\"https://image.example/42.jpg\"}}]},\"mainState\":[{\"type\":\"textAtom\",\"textAtom\":{\"text\":\"Phone\"}},{\"type\":\"priceV2\",\"priceV2\":{\"price\":[{\"textStyle\":\"PRICE\",\"text\":\"1 234 ₽\"},{\"textStyle\":\"ORIGINAL_PRICE\",\"text\":\"1 500 ₽\"}]}}]}]}"
-        }
-    }`)
+	"agregator/internal/search"
+)
+
+const searchBody = `{
+    "widgetStates": {
+        "tileGridDesktop-1": "{\"items\":[{\"sku\":\"42\",\"action\":{\"link\":\"/product/42\"},\"tileImage\":{\"items\":[{\"image\":{\"link\":\"https://image.example/42.jpg\"}}]},\"mainState\":[{\"type\":\"textAtom\",\"textAtom\":{\"text\":\"Phone\"}},{\"type\":\"priceV2\",\"priceV2\":{\"price\":[{\"textStyle\":\"PRICE\",\"text\":\"1 234 ₽\"},{\"textStyle\":\"ORIGINAL_PRICE\",\"text\":\"1 500 ₽\"}]}}]}]}"
+    }
+}`
 
-	products, err := parseProducts(body)
+func TestParseProducts(t *testing.T) {
+	products, err := parseProducts([]byte(searchBody))
 	if err != nil {
 		t.Fatalf("parseProducts() error = %v", err)
 	}
@@ -17,6 +30,9 @@ func TestParseProducts(t *testing.T) {
 		t.Fatalf("parseProducts() returned %d products, want 1", len(products))
 	}
 	got := products[0]
+	if got.Marketplace != Name || got.Key != "ozon:42" {
+		t.Fatalf("unexpected source: %#v", got)
+	}
 	if got.Link != "https://www.ozon.ru/product/42" {
 		t.Fatalf("Link = %q", got.Link)
 	}
@@ -31,3 +47,114 @@ func TestParseProductsRejectsInvalidPrice(t *testing.T) {
 		t.Fatal("parseProducts() error = nil, want invalid price error")
 	}
 }
+
+type fakeOzon struct {
+	site, api *httptest.Server
+	warmUps   atomic.Int32
+	requests  atomic.Int32
+}
+
+// newFakeOzon serves the site and the composer API. The API requires the
+// cookie set by the site and answers with api.
+func newFakeOzon(t *testing.T, api func(w http.ResponseWriter, r *http.Request)) *fakeOzon {
+	t.Helper()
+	f := &fakeOzon{}
+	f.site = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.warmUps.Add(1)
+		http.SetCookie(w, &http.Cookie{Name: "abt_data", Value: "1", Path: "/"})
+	}))
+	t.Cleanup(f.site.Close)
+	f.api = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.requests.Add(1)
+		if r.URL.Path != "/composer-api.bx/page/json/v2" || r.Header.Get("Origin") != f.site.URL {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		api(w, r)
+	}))
+	t.Cleanup(f.api.Close)
+	return f
+}
+
+func (f *fakeOzon) client(delays *[]time.Duration) *Client {
+	c := New(slog.Default(), WithAPIURL(f.api.URL), WithSiteURL(f.site.URL+"/"))
+	c.sleep = func(_ context.Context, d time.Duration) error {
+		*delays = append(*delays, d)
+		return nil
+	}
+	return c
+}
+
+func TestSearchFollowsRedirect(t *testing.T) {
+	fake := newFakeOzon(t, func(w http.ResponseWriter, r *http.Request) {
+		page := r.URL.Query().Get("url")
+		if !strings.Contains(page, "text=phone") || !strings.Contains(page, "page=1") {
+			http.Error(w, "unexpected page "+page, http.StatusBadRequest)
+			return
+		}
+		if r.URL.Query().Get("redirected") == "" {
+			http.Redirect(w, r, "/composer-api.bx/page/json/v2?url="+url.QueryEscape(page)+"&redirected=1", http.StatusTemporaryRedirect)
+			return
+		}
+		w.Write([]byte(searchBody))
+	})
+
+	var delays []time.Duration
+	products, err := fake.client(&delays).Search(context.Background(), "phone")
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	if len(products) != 1 || products[0].ProductID != "42" {
+		t.Fatalf("products = %#v", products)
+	}
+	if fake.warmUps.Load() != 1 || fake.requests.Load() != 2 {
+		t.Fatalf("warm-ups = %d, API requests = %d, want 1 and 2", fake.warmUps.Load(), fake.requests.Load())
+	}
+	// A random pause before each request and a fixed one after the redirect.
+	if len(delays) != 3 || delays[1] != 2*time.Second {
+		t.Fatalf("delays = %v", delays)
+	}
+}
+
+func TestSearchGivesUpOnRepeatedRedirects(t *testing.T) {
+	fake := newFakeOzon(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "composer-api.bx/page/json/v2?url="+url.QueryEscape(r.URL.Query().Get("url")), http.StatusFound)
+	})
+
+	var delays []time.Duration
+	_, err := fake.client(&delays).Search(context.Background(), "phone")
+	if !errors.Is(err, search.ErrUnavailable) {
+		t.Fatalf("Search() error = %v, want %v", err, search.ErrUnavailable)
+	}
+	if fake.requests.Load() != 2 {
+		t.Fatalf("API requests = %d, want 2", fake.requests.Load())
+	}
+}
+
+func TestSearchWarmsUpAgainAfterBlock(t *testing.T) {
+	var blocked atomic.Bool
+	blocked.Store(true)
+	fake := newFakeOzon(t, func(w http.ResponseWriter, r *http.Request) {
+		if _, err := r.Cookie("abt_data"); err != nil || blocked.Load() {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Write([]byte(searchBody))
+	})
+
+	var delays []time.Duration
+	client := fake.client(&delays)
+	if _, err := client.Search(context.Background(), "phone"); !errors.Is(err, search.ErrRateLimited) {
+		t.Fatalf("Search() error = %v, want %v", err, search.ErrRateLimited)
+	}
+	blocked.Store(false)
+	if _, err := client.Search(context.Background(), "phone"); err != nil {
+		t.Fatalf("Search() after the block error = %v", err)
+	}
+	if _, err := client.Search(context.Background(), "phone"); err != nil {
+		t.Fatalf("third Search() error = %v", err)
+	}
+	if fake.warmUps.Load() != 2 {
+		t.Fatalf("warm-ups = %d, want a new one only after the block", fake.warmUps.Load())
+	}
+}
@@ -0,0 +1,64 @@
+package marketplace
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"agregator/internal/product"
+)
+
+type PageFetcher func(ctx context.Context, page int) ([]product.Product, error)
+
+// FetchPages requests pages 1..pages with at most concurrency requests in
+// flight and merges them in page order without duplicate product IDs. The first
+// page is required; a failed later page only truncates the result, because the
+// store may simply have fewer pages or the deadline may expire mid-way.
+func FetchPages(ctx context.Context, pages, concurrency int, fetch PageFetcher) ([]product.Product, []error, error) {
+	pages = max(pages, 1)
+	concurrency = max(concurrency, 1)
+
+	results := make([][]product.Product, pages)
+	errs := make([]error, pages)
+	semaphore := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for page := 1; page <= pages; page++ {
+		select {
+		case semaphore <- struct{}{}:
+		case <-ctx.Done():
+			errs[page-1] = ctx.Err()
+			continue
+		}
+		wg.Add(1)
+		go func(page int) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			results[page-1], errs[page-1] = fetch(ctx, page)
+		}(page)
+	}
+	wg.Wait()
+
+	if errs[0] != nil {
+		return nil, nil, errs[0]
+	}
+
+	var (
+		products []product.Product
+		pageErrs []error
+	)
+	seen := make(map[string]bool)
+	for i, result := range results {
+		if errs[i] != nil {
+			pageErrs = append(pageErrs, fmt.Errorf("page %d: %w", i+1, errs[i]))
+			continue
+		}
+		for _, p := range result {
+			if seen[p.ProductID] {
+				continue
+			}
+			seen[p.ProductID] = true
+			products = append(products, p)
+		}
+	}
+	return products, pageErrs, nil
+}
@@ -0,0 +1,63 @@
+package marketplace
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	"agregator/internal/product"
+)
+
+func TestFetchPagesMergesAndDeduplicates(t *testing.T) {
+	var inFlight, maxInFlight atomic.Int32
+	products, pageErrs, err := FetchPages(context.Background(), 4, 2, func(_ context.Context, page int) ([]product.Product, error) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			current := maxInFlight.Load()
+			if n <= current || maxInFlight.CompareAndSwap(current, n) {
+				break
+			}
+		}
+
+		switch page {
+		case 1:
+			return []product.Product{{ProductID: "1"}, {ProductID: "2"}}, nil
+		case 2:
+			return []product.Product{{ProductID: "2"}, {ProductID: "3"}}, nil
+		case 3:
+			return nil, errors.New("blocked")
+		default:
+			return []product.Product{{ProductID: "4"}}, nil
+		}
+	})
+	if err != nil {
+		t.Fatalf("FetchPages() error = %v", err)
+	}
+	if len(pageErrs) != 1 {
+		t.Fatalf("page errors = %v, want one", pageErrs)
+	}
+	var ids []string
+	for _, p := range products {
+		ids = append(ids, p.ProductID)
+	}
+	if len(ids) != 4 || ids[0] != "1" || ids[1] != "2" || ids[2] != "3" || ids[3] != "4" {
+		t.Fatalf("product IDs = %v", ids)
+	}
+	if maxInFlight.Load() > 2 {
+		t.Fatalf("max concurrent pages = %d, want at most 2", maxInFlight.Load())
+	}
+}
+
+func TestFetchPagesRequiresFirstPage(t *testing.T) {
+	_, _, err := FetchPages(context.Background(), 2, 2, func(_ context.Context, page int) ([]product.Product, error) {
+		if page == 1 {
+			return nil, errors.New("unavailable")
+		}
+		return []product.Product{{ProductID: "2"}}, nil
+	})
+	if err == nil {
+		t.Fatal("FetchPages() error = nil, want first page error")
+	}
+}
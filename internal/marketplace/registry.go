@@ -0,0 +1,147 @@
+package marketplace
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"agregator/internal/product"
+	"agregator/internal/search"
+)
+
+type Capability string
+
+const (
+	CapabilitySearch  Capability = "search"
+	CapabilityRatings Capability = "ratings"
+	CapabilityImages  Capability = "images"
+)
+
+// Info describes an adapter: how it is identified in configuration, logs and
+// responses and which defaults it is started with.
+type Info struct {
+	Name         string
+	Label        string
+	BaseURL      string
+	Timeout      time.Duration
+	Capabilities []Capability
+}
+
+func (i Info) Has(capability Capability) bool {
+	return slices.Contains(i.Capabilities, capability)
+}
+
+type Factory func(logger *slog.Logger) search.Marketplace
+
+type entry struct {
+	info    Info
+	factory Factory
+}
+
+type Registry struct {
+	entries []entry
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) Register(info Info, factory Factory) error {
+	if info.Name == "" {
+		return fmt.Errorf("register marketplace: empty name")
+	}
+	if factory == nil {
+		return fmt.Errorf("register marketplace %q: nil factory", info.Name)
+	}
+	if _, ok := r.Lookup(info.Name); ok {
+		return fmt.Errorf("register marketplace %q: already registered", info.Name)
+	}
+	r.entries = append(r.entries, entry{info: info, factory: factory})
+	return nil
+}
+
+func (r *Registry) MustRegister(info Info, factory Factory) {
+	if err := r.Register(info, factory); err != nil {
+		panic(err)
+	}
+}
+
+func (r *Registry) Lookup(name string) (Info, bool) {
+	e, ok := r.entry(name)
+	return e.info, ok
+}
+
+// List returns the registered adapters in registration order.
+func (r *Registry) List() []Info {
+	infos := make([]Info, 0, len(r.entries))
+	for _, e := range r.entries {
+		infos = append(infos, e.info)
+	}
+	return infos
+}
+
+// Build creates the enabled adapters. An empty list enables every registered
+// adapter.
+func (r *Registry) Build(logger *slog.Logger, enabled []string) ([]search.Marketplace, error) {
+	if len(enabled) == 0 {
+		for _, e := range r.entries {
+			enabled = append(enabled, e.info.Name)
+		}
+	}
+
+	marketplaces := make([]search.Marketplace, 0, len(enabled))
+	seen := make(map[string]bool, len(enabled))
+	for _, name := range enabled {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		e, ok := r.entry(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown marketplace %q", name)
+		}
+		var m search.Marketplace = e.factory(logger)
+		if e.info.Timeout > 0 {
+			m = &timeoutMarketplace{Marketplace: m, timeout: e.info.Timeout}
+		}
+		marketplaces = append(marketplaces, m)
+	}
+	return marketplaces, nil
+}
+
+func (r *Registry) entry(name string) (entry, bool) {
+	for _, e := range r.entries {
+		if e.info.Name == name {
+			return e, true
+		}
+	}
+	return entry{}, false
+}
+
+// ParseNames splits a comma separated list of marketplace names such as the
+// MARKETPLACES environment variable.
+func ParseNames(value string) []string {
+	var names []string
+	for _, name := range strings.Split(value, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+type timeoutMarketplace struct {
+	search.Marketplace
+	timeout time.Duration
+}
+
+func (m *timeoutMarketplace) Search(ctx context.Context, query string) ([]product.Product, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+	return m.Marketplace.Search(ctx, query)
+}
@@ -0,0 +1,69 @@
+package marketplace
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	"agregator/internal/product"
+	"agregator/internal/search"
+)
+
+type fakeMarketplace struct {
+	name     string
+	deadline bool
+}
+
+func (m *fakeMarketplace) Name() string {
+	return m.name
+}
+
+func (m *fakeMarketplace) Search(ctx context.Context, _ string) ([]product.Product, error) {
+	_, m.deadline = ctx.Deadline()
+	return nil, nil
+}
+
+func factory(name string) Factory {
+	return func(*slog.Logger) search.Marketplace { return &fakeMarketplace{name: name} }
+}
+
+func TestRegistryBuildsEnabledMarketplaces(t *testing.T) {
+	registry := NewRegistry()
+	registry.MustRegister(Info{Name: "ozon"}, factory("ozon"))
+	registry.MustRegister(Info{Name: "wb", Timeout: time.Second}, factory("wb"))
+
+	all, err := registry.Build(slog.Default(), nil)
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	if len(all) != 2 || all[0].Name() != "ozon" || all[1].Name() != "wb" {
+		t.Fatalf("Build() = %#v", all)
+	}
+
+	enabled, err := registry.Build(slog.Default(), ParseNames(" WB , wb,"))
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	if len(enabled) != 1 || enabled[0].Name() != "wb" {
+		t.Fatalf("Build() = %#v", enabled)
+	}
+	if _, err := enabled[0].Search(context.Background(), "phone"); err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	if !enabled[0].(*timeoutMarketplace).Marketplace.(*fakeMarketplace).deadline {
+		t.Fatal("default timeout was not applied")
+	}
+}
+
+func TestRegistryRejectsUnknownAndDuplicateNames(t *testing.T) {
+	registry := NewRegistry()
+	registry.MustRegister(Info{Name: "ozon"}, factory("ozon"))
+
+	if err := registry.Register(Info{Name: "ozon"}, factory("ozon")); err == nil {
+		t.Fatal("Register() error = nil, want duplicate error")
+	}
+	if _, err := registry.Build(slog.Default(), []string{"avito"}); err == nil {
+		t.Fatal("Build() error = nil, want unknown marketplace error")
+	}
+}
@@ -0,0 +1,119 @@
+package marketplace
+
+import (
+	"context"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// HTTPConfig configures the HTTP sessions of the adapters. The zero value is
+// ready to use.
+type HTTPConfig struct {
+	// Proxy is the HTTP proxy for marketplace requests, none when nil.
+	Proxy *url.URL
+	// Timeout limits one request, 15s by default.
+	Timeout time.Duration
+	// MaxConnsPerHost limits the connections to one host, 8 by default.
+	MaxConnsPerHost int
+	// WarmUpInterval is how long the cookies of a warm-up are trusted before
+	// the next search warms the session up again, 30m by default.
+	WarmUpInterval time.Duration
+	// Transport replaces the pooled transport, for example to send the
+	// requests of tests to a local server. Proxy and MaxConnsPerHost are
+	// ignored then.
+	Transport http.RoundTripper
+}
+
+const (
+	defaultRequestTimeout  = 15 * time.Second
+	defaultMaxConnsPerHost = 8
+	defaultWarmUpInterval  = 30 * time.Minute
+)
+
+// Session is the HTTP client of an adapter. It is shared by all searches, so
+// connections and TLS sessions are reused and the cookie jar keeps the
+// cookies of the last warm-up. Redirects are returned to the caller instead of
+// being followed.
+type Session struct {
+	client   *http.Client
+	jar      *cookiejar.Jar
+	interval time.Duration
+	now      func() time.Time
+
+	mu       sync.Mutex
+	warmedAt time.Time
+}
+
+func NewSession(config HTTPConfig) *Session {
+	if config.Timeout <= 0 {
+		config.Timeout = defaultRequestTimeout
+	}
+	if config.WarmUpInterval <= 0 {
+		config.WarmUpInterval = defaultWarmUpInterval
+	}
+	transport := config.Transport
+	if transport == nil {
+		pooled := http.DefaultTransport.(*http.Transport).Clone()
+		pooled.Proxy = nil
+		if config.Proxy != nil {
+			pooled.Proxy = http.ProxyURL(config.Proxy)
+		}
+		pooled.MaxConnsPerHost = config.MaxConnsPerHost
+		if pooled.MaxConnsPerHost <= 0 {
+			pooled.MaxConnsPerHost = defaultMaxConnsPerHost
+		}
+		pooled.MaxIdleConnsPerHost = pooled.MaxConnsPerHost
+		transport = pooled
+	}
+	// cookiejar.New fails only on invalid options.
+	jar, _ := cookiejar.New(nil)
+	return &Session{
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   config.Timeout,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+			Jar: jar,
+		},
+		jar:      jar,
+		interval: config.WarmUpInterval,
+		now:      time.Now,
+	}
+}
+
+func (s *Session) Do(request *http.Request) (*http.Response, error) {
+	return s.client.Do(request)
+}
+
+// SetCookies adds cookies for u, such as cookies exported from a browser.
+func (s *Session) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	s.jar.SetCookies(u, cookies)
+}
+
+// WarmUp calls warmUp if the session has not been warmed up within the
+// interval. Concurrent searches wait for a single warm-up; a failed warm-up
+// is retried by the next search.
+func (s *Session) WarmUp(ctx context.Context, warmUp func(context.Context) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.warmedAt.IsZero() && s.now().Sub(s.warmedAt) < s.interval {
+		return nil
+	}
+	if err := warmUp(ctx); err != nil {
+		return err
+	}
+	s.warmedAt = s.now()
+	return nil
+}
+
+// Expire makes the next search warm the session up again, for example after
+// the marketplace rejected its cookies.
+func (s *Session) Expire() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.warmedAt = time.Time{}
+}
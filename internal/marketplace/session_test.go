@@ -0,0 +1,95 @@
+package marketplace
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSessionKeepsCookiesAndConnections(t *testing.T) {
+	var newConns atomic.Int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/warmup" {
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc"})
+			return
+		}
+		if cookie, err := r.Cookie("session"); err != nil || cookie.Value != "abc" {
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			newConns.Add(1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	session := NewSession(HTTPConfig{})
+	get := func(path string) int {
+		request, _ := http.NewRequest(http.MethodGet, server.URL+path, nil)
+		response, err := session.Do(request)
+		if err != nil {
+			t.Fatalf("Do(%s) error = %v", path, err)
+		}
+		response.Body.Close()
+		return response.StatusCode
+	}
+	get("/warmup")
+	for range 3 {
+		if status := get("/search"); status != http.StatusOK {
+			t.Fatalf("search status = %d, want the warm-up cookie to be sent", status)
+		}
+	}
+	if n := newConns.Load(); n != 1 {
+		t.Fatalf("opened %d connections, want 1", n)
+	}
+}
+
+func TestSessionWarmsUpPeriodically(t *testing.T) {
+	session := NewSession(HTTPConfig{WarmUpInterval: time.Hour})
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	session.now = func() time.Time { return now }
+
+	var warmUps int
+	warmUp := func(context.Context) error {
+		warmUps++
+		return nil
+	}
+	ctx := context.Background()
+	for _, step := range []struct {
+		advance time.Duration
+		expire  bool
+		want    int
+	}{
+		{0, false, 1},
+		{30 * time.Minute, false, 1},
+		{31 * time.Minute, false, 2},
+		{time.Minute, true, 3},
+	} {
+		now = now.Add(step.advance)
+		if step.expire {
+			session.Expire()
+		}
+		if err := session.WarmUp(ctx, warmUp); err != nil {
+			t.Fatalf("WarmUp() error = %v", err)
+		}
+		if warmUps != step.want {
+			t.Fatalf("after %v: %d warm-ups, want %d", step.advance, warmUps, step.want)
+		}
+	}
+
+	session.Expire()
+	failed := errors.New("blocked")
+	if err := session.WarmUp(ctx, func(context.Context) error { return failed }); !errors.Is(err, failed) {
+		t.Fatalf("WarmUp() error = %v, want %v", err, failed)
+	}
+	if err := session.WarmUp(ctx, warmUp); err != nil || warmUps != 4 {
+		t.Fatalf("warm-up after a failure: %d warm-ups, %v", warmUps, err)
+	}
+}
@@ -7,36 +7,129 @@ import (
 	"io"
 	"log/slog"
 	"net/http"
-	"net/http/cookiejar"
 	"net/url"
-	"os"
 	"strconv"
 	"strings"
 	"time"
 
+	"agregator/internal/marketplace"
 	"agregator/internal/product"
 
 	"github.com/tidwall/gjson"
 )
 
+const Name = "wb"
+
+var Info = marketplace.Info{
+	Name:    Name,
+	Label:   "Wildberries",
+	BaseURL: defaultSiteURL,
+	Timeout: 30 * time.Second,
+	Capabilities: []marketplace.Capability{
+		marketplace.CapabilitySearch,
+		marketplace.CapabilityRatings,
+		marketplace.CapabilityImages,
+	},
+}
+
+const (
+	defaultPages       = 1
+	concurrentRequests = 3
+	defaultSearchURL   = "https://search.wb.ru/exactmatch/ru/common/v18/search"
+	defaultSiteURL     = "https://www.wildberries.ru"
+)
+
 type Client struct {
-	logger *slog.Logger
+	logger     *slog.Logger
+	pages      int
+	searchURL  string
+	siteURL    string
+	httpConfig marketplace.HTTPConfig
+	session    *marketplace.Session
+	// sleep pauses between retries; tests replace it to run without delays.
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+type Option func(*Client)
+
+// WithPages sets how many search result pages are requested per query.
+func WithPages(pages int) Option {
+	return func(c *Client) {
+		if pages > 0 {
+			c.pages = pages
+		}
+	}
+}
+
+// WithSearchURL replaces the search endpoint
+// https://search.wb.ru/exactmatch/ru/common/v18/search.
+func WithSearchURL(searchURL string) Option {
+	return func(c *Client) {
+		if searchURL != "" {
+			c.searchURL = searchURL
+		}
+	}
+}
+
+// WithSiteURL replaces https://www.wildberries.ru, which is requested to warm
+// up the session and sent as the origin of search requests.
+func WithSiteURL(siteURL string) Option {
+	return func(c *Client) {
+		if siteURL != "" {
+			c.siteURL = strings.TrimRight(siteURL, "/")
+		}
+	}
+}
+
+// WithHTTP configures the session the client keeps for all searches.
+func WithHTTP(config marketplace.HTTPConfig) Option {
+	return func(c *Client) {
+		c.httpConfig = config
+	}
+}
+
+func New(logger *slog.Logger, options ...Option) *Client {
+	c := &Client{
+		logger:    logger.With("marketplace", Name),
+		pages:     defaultPages,
+		searchURL: defaultSearchURL,
+		siteURL:   defaultSiteURL,
+		sleep:     wait,
+	}
+	for _, option := range options {
+		option(c)
+	}
+	c.session = marketplace.NewSession(c.httpConfig)
+	return c
 }
 
-func New(logger *slog.Logger) *Client {
-	return &Client{logger: logger.With("marketplace", "wb")}
+func (c *Client) Name() string {
+	return Name
 }
 
 func (c *Client) Search(ctx context.Context, query string) ([]product.Product, error) {
-	body, err := c.wildberries(ctx, query)
-	if err != nil {
-		return nil, fmt.Errorf("[WB] ошибка сбора json WB:%w", err)
+	if err := c.session.WarmUp(ctx, c.warmUp); err != nil {
+		return nil, fmt.Errorf("[WB] Warmup errors:%w", err)
 	}
-	products, err := parseProducts(body)
+
+	products, pageErrs, err := marketplace.FetchPages(ctx, c.pages, concurrentRequests, func(ctx context.Context, page int) ([]product.Product, error) {
+		body, err := c.wildberries(ctx, query, page)
+		if err != nil {
+			return nil, fmt.Errorf("[WB] ошибка сбора json WB:%w", err)
+		}
+		products, err := parseProducts(body)
+		if err != nil {
+			return nil, marketplace.BadResponse(err)
+		}
+		return products, nil
+	})
 	if err != nil {
 		return nil, err
 	}
-	c.logger.Info("parsed products", "count", len(products))
+	for _, err := range pageErrs {
+		c.logger.Warn("additional page failed", "error", err)
+	}
+	c.logger.Info("parsed products", "count", len(products), "pages", c.pages)
 	return products, nil
 }
 
@@ -54,7 +147,7 @@ func parseProducts(body []byte) ([]product.Product, error) {
 
 	products.ForEach(func(_, products gjson.Result) bool {
 		id := products.Get("id").Int()
-		link := "https://www.wildberries.ru/catalog/" + strconv.FormatInt(id, 10) + "/detail.aspx"
+		link := defaultSiteURL + "/catalog/" + strconv.FormatInt(id, 10) + "/detail.aspx"
 		name := products.Get("name").String()
 		discountPrice := products.Get("sizes.0.price.product")
 		if !discountPrice.Exists() || discountPrice.Int() <= 0 {
@@ -154,10 +247,13 @@ func parseProducts(body []byte) ([]product.Product, error) {
 			"https://basket-%s.wbbasket.ru/vol%d/part%d/%d/images/big/1.webp",
 			host, vol, part, id)
 
+		productID := strconv.FormatInt(id, 10)
 		p := product.Product{
+			Marketplace:          Name,
+			Key:                  product.Key(Name, productID),
 			Link:                 link,
 			IMG:                  pic,
-			ProductID:            strconv.FormatInt(id, 10),
+			ProductID:            productID,
 			ProductName:          name,
 			DiscountPriceKopecks: discountPrice.Int(),
 			BasePriceKopecks:     basePrice.Int(),
@@ -174,7 +270,7 @@ func parseProducts(body []byte) ([]product.Product, error) {
 	return items, nil
 }
 
-func setHeaders(req *http.Request, referer string) {
+func setHeaders(req *http.Request, origin, referer string) {
 	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/119.0.6045.105 Safari/537.36")
 	req.Header.Set("Accept", "application/json, text/plain, */*")
 	req.Header.Set("Accept-Language", "ru-RU,ru;q=0.9,en-US;q=0.8,en;q=0.7")
@@ -182,20 +278,20 @@ func setHeaders(req *http.Request, referer string) {
 	req.Header.Set("Sec-Fetch-Site", "same-site")
 	req.Header.Set("Sec-Fetch-Mode", "cors")
 	req.Header.Set("Sec-Fetch-Dest", "empty")
-	req.Header.Set("Origin", "https://www.wildberries.ru")
+	req.Header.Set("Origin", origin)
 	req.Header.Set("X-Requested-With", "XMLHttpRequest")
 	if referer != "" {
 		req.Header.Set("Referer", referer)
 	}
 }
 
-func warmUp(ctx context.Context, client *http.Client) error {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://www.wildberries.ru/", nil)
+func (c *Client) warmUp(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.siteURL+"/", nil)
 	if err != nil {
 		return err
 	}
-	setHeaders(req, "")
-	resp, err := client.Do(req)
+	setHeaders(req, c.siteURL, "")
+	resp, err := c.session.Do(req)
 	if err != nil {
 		return err
 	}
@@ -205,47 +301,19 @@ func warmUp(ctx context.Context, client *http.Client) error {
 	return nil
 }
 
-func (c *Client) wildberries(ctx context.Context, query string) ([]byte, error) {
-	apiUrl := "https://search.wb.ru/exactmatch/ru/common/v18/search?appType=1&curr=rub&dest=-1257786&lang=ru&page=1&query=" + url.QueryEscape(query) + "&resultset=catalog&sort=priceup&spp=30"
-	referer := "https://www.wildberries.ru/catalog/0/search.aspx?search=" + url.QueryEscape(query)
-
-	jar, err := cookiejar.New(nil)
-	if err != nil {
-		return nil, fmt.Errorf("[WB] ошибка cookiejar:%w", err)
-	}
-
-	transport := http.DefaultTransport.(*http.Transport).Clone()
-	transport.Proxy = nil
-	proxyURLText := strings.TrimSpace(os.Getenv("PROXY_URL"))
-	if proxyURLText != "" {
-		proxyURL, err := url.Parse(proxyURLText)
-		if err != nil {
-			return nil, fmt.Errorf("parse PROXY_URL: %w", err)
-		}
-		transport.Proxy = http.ProxyURL(proxyURL)
-		c.logger.Info("using proxy from environment")
-	}
-	client := &http.Client{
-		Transport: transport,
-		Timeout:   15 * time.Second,
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			return http.ErrUseLastResponse
-		},
-		Jar: jar,
-	}
-
-	if err := warmUp(ctx, client); err != nil {
-		return nil, fmt.Errorf("[WB] Warmup errors:%w", err)
-	}
+func (c *Client) wildberries(ctx context.Context, query string, page int) ([]byte, error) {
+	apiUrl := c.searchURL + "?appType=1&curr=rub&dest=-1257786&lang=ru&page=" + strconv.Itoa(page) + "&query=" + url.QueryEscape(query) + "&resultset=catalog&sort=priceup&spp=30"
+	referer := c.siteURL + "/catalog/0/search.aspx?search=" + url.QueryEscape(query)
 
+	var lastStatus int
 	for attempt := 0; attempt <= 10; attempt++ {
-		c.logger.Debug("request attempt", "attempt", attempt+1, "url", apiUrl)
+		c.logger.Debug("request attempt", "page", page, "attempt", attempt+1, "url", apiUrl)
 		req, err := http.NewRequestWithContext(ctx, http.MethodGet, apiUrl, nil)
 		if err != nil {
 			return nil, fmt.Errorf("create request: %w", err)
 		}
-		setHeaders(req, referer)
-		resp, err := client.Do(req)
+		setHeaders(req, c.siteURL, referer)
+		resp, err := c.session.Do(req)
 		if err != nil {
 			if ctx.Err() != nil {
 				return nil, ctx.Err()
@@ -264,7 +332,11 @@ func (c *Client) wildberries(ctx context.Context, query string) ([]byte, error)
 			c.logger.Debug("request completed", "status", resp.StatusCode)
 			return body, nil
 		}
-		if err := wait(ctx, 2*time.Second); err != nil {
+		lastStatus = resp.StatusCode
+		if resp.StatusCode == http.StatusForbidden {
+			c.session.Expire()
+		}
+		if err := c.sleep(ctx, 2*time.Second); err != nil {
 			return nil, err
 		}
 		if len(body) > 0 {
@@ -276,7 +348,7 @@ func (c *Client) wildberries(ctx context.Context, query string) ([]byte, error)
 		}
 		c.logger.Warn("unexpected response status", "status", resp.StatusCode)
 	}
-	return nil, errors.New("[WB]  не удалось получить данные")
+	return nil, fmt.Errorf("[WB]  не удалось получить данные: %w", marketplace.StatusError(lastStatus))
 }
 
 func wait(ctx context.Context, d time.Duration) error {
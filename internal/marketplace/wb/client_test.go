@@ -1,6 +1,20 @@
 package wb
 
-import "testing"
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"agregator/internal/marketplace"
+	"agregator/internal/search"
+)
 
 func TestParseProducts(t *testing.T) {
 	body := []byte(`{"products":[{"id":123456,"name":"Phone","rating":4.8,"feedbacks":12,"sizes":[{"price":{"product":123400,"basic":150000}}]}]}`)
@@ -16,6 +30,9 @@ func TestParseProducts(t *testing.T) {
 	if got.ProductID != "123456" {
 		t.Fatalf("ProductID = %q", got.ProductID)
 	}
+	if got.Marketplace != Name || got.Key != "wb:123456" {
+		t.Fatalf("unexpected source: %#v", got)
+	}
 	if got.DiscountPriceKopecks != 123_400 || got.BasePriceKopecks != 150_000 {
 		t.Fatalf("unexpected prices: %#v", got)
 	}
@@ -27,3 +44,130 @@ func TestParseProductsRejectsMissingPrice(t *testing.T) {
 		t.Fatal("parseProducts() error = nil, want missing price error")
 	}
 }
+
+// redirectTransport sends every request to a test server and records the
+// original URLs.
+type redirectTransport struct {
+	target *url.URL
+
+	mu       sync.Mutex
+	requests []string
+}
+
+func (t *redirectTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	t.requests = append(t.requests, request.URL.Host+request.URL.Path)
+	t.mu.Unlock()
+	request = request.Clone(request.Context())
+	request.URL.Scheme, request.URL.Host = t.target.Scheme, t.target.Host
+	return http.DefaultTransport.RoundTrip(request)
+}
+
+func TestClientKeepsSessionBetweenSearches(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			return
+		}
+		w.Write([]byte(searchBody))
+	}))
+	defer server.Close()
+	target, _ := url.Parse(server.URL)
+	transport := &redirectTransport{target: target}
+
+	client := New(slog.Default(), WithHTTP(marketplace.HTTPConfig{Transport: transport}))
+	for range 2 {
+		products, err := client.Search(context.Background(), "phone")
+		if err != nil || len(products) != 1 {
+			t.Fatalf("Search() = %d products, %v", len(products), err)
+		}
+	}
+
+	want := []string{"www.wildberries.ru/", "search.wb.ru/exactmatch/ru/common/v18/search", "search.wb.ru/exactmatch/ru/common/v18/search"}
+	if len(transport.requests) != len(want) {
+		t.Fatalf("requests = %v, want one warm-up and two searches", transport.requests)
+	}
+	for i := range want {
+		if transport.requests[i] != want[i] {
+			t.Fatalf("requests = %v, want %v", transport.requests, want)
+		}
+	}
+}
+
+const searchBody = `{"products":[{"id":1,"name":"Phone","sizes":[{"price":{"product":100000}}]}]}`
+
+// newFakeWB serves the site and the search endpoint, which answers with the
+// statuses in order and then with searchBody.
+func newFakeWB(t *testing.T, statuses ...int) (*Client, *atomic.Int32, *[]time.Duration) {
+	t.Helper()
+	var requests atomic.Int32
+	site := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	t.Cleanup(site.Close)
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(requests.Add(1))
+		if r.URL.Query().Get("query") != "phone" || r.Header.Get("Origin") != site.URL {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		if n <= len(statuses) {
+			w.WriteHeader(statuses[n-1])
+			return
+		}
+		w.Write([]byte(searchBody))
+	}))
+	t.Cleanup(api.Close)
+
+	client := New(slog.Default(), WithSearchURL(api.URL+"/exactmatch/ru/common/v18/search"), WithSiteURL(site.URL))
+	var delays []time.Duration
+	client.sleep = func(_ context.Context, d time.Duration) error {
+		delays = append(delays, d)
+		return nil
+	}
+	return client, &requests, &delays
+}
+
+func TestSearchRetriesFailedRequests(t *testing.T) {
+	client, requests, delays := newFakeWB(t, http.StatusTooManyRequests, http.StatusInternalServerError)
+
+	products, err := client.Search(context.Background(), "phone")
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	if len(products) != 1 || products[0].ProductID != "1" {
+		t.Fatalf("products = %#v", products)
+	}
+	if requests.Load() != 3 || len(*delays) != 2 || (*delays)[0] != 2*time.Second {
+		t.Fatalf("requests = %d, delays = %v, want 3 requests after two pauses", requests.Load(), *delays)
+	}
+}
+
+func TestSearchGivesUpAfterRetries(t *testing.T) {
+	statuses := make([]int, 20)
+	for i := range statuses {
+		statuses[i] = http.StatusServiceUnavailable
+	}
+	client, requests, _ := newFakeWB(t, statuses...)
+
+	_, err := client.Search(context.Background(), "phone")
+	if !errors.Is(err, search.ErrUnavailable) {
+		t.Fatalf("Search() error = %v, want %v", err, search.ErrUnavailable)
+	}
+	if requests.Load() != 11 {
+		t.Fatalf("requests = %d, want 11", requests.Load())
+	}
+}
+
+func TestSearchStopsRetryingWhenCanceled(t *testing.T) {
+	client, requests, _ := newFakeWB(t, http.StatusTooManyRequests, http.StatusTooManyRequests)
+	ctx, cancel := context.WithCancel(context.Background())
+	client.sleep = func(context.Context, time.Duration) error {
+		cancel()
+		return context.Canceled
+	}
+
+	if _, err := client.Search(ctx, "phone"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Search() error = %v, want %v", err, context.Canceled)
+	}
+	if requests.Load() != 1 {
+		t.Fatalf("requests = %d, want 1", requests.Load())
+	}
+}
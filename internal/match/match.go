@@ -0,0 +1,312 @@
+package match
+
+import (
+	"cmp"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"agregator/internal/product"
+)
+
+// Cluster is one product sold by several offers, possibly on different
+// marketplaces.
+type Cluster struct {
+	Key          string            `json:"cluster_key"`
+	Name         string            `json:"name"`
+	BestPrice    int64             `json:"best_price"`
+	BestOffer    product.Product   `json:"best_offer"`
+	Marketplaces []string          `json:"marketplaces"`
+	Offers       []product.Product `json:"offers"`
+}
+
+// minSimilarity is the Jaccard index of model tokens two names need in addition
+// to compatible kind, brand, numbers, modifiers, storage and color.
+const minSimilarity = 0.5
+
+var brands = map[string]string{
+	"apple": "apple", "эпл": "apple", "samsung": "samsung", "самсунг": "samsung",
+	"xiaomi": "xiaomi", "сяоми": "xiaomi", "redmi": "xiaomi", "poco": "xiaomi",
+	"huawei": "huawei", "хуавей": "huawei", "honor": "honor", "хонор": "honor",
+	"realme": "realme", "oneplus": "oneplus", "google": "google", "sony": "sony",
+	"nokia": "nokia", "tecno": "tecno", "infinix": "infinix", "vivo": "vivo",
+	"oppo": "oppo", "motorola": "motorola", "lenovo": "lenovo", "asus": "asus",
+	"acer": "acer", "hp": "hp", "dell": "dell", "lg": "lg", "philips": "philips",
+}
+
+var colors = map[string]string{
+	"черный": "black", "black": "black", "графитовый": "black",
+	"белый": "white", "white": "white",
+	"серый": "gray", "gray": "gray", "grey": "gray",
+	"серебристый": "silver", "silver": "silver",
+	"золотой": "gold", "gold": "gold",
+	"синий": "blue", "blue": "blue", "голубой": "blue",
+	"зеленый": "green", "green": "green",
+	"красный": "red", "red": "red",
+	"розовый": "pink", "pink": "pink",
+	"желтый": "yellow", "yellow": "yellow",
+	"фиолетовый": "purple", "purple": "purple",
+}
+
+// modifiers distinguish models that share a name and a number, e.g. iPhone 15
+// and iPhone 15 Pro, so they must match exactly.
+var modifiers = map[string]bool{
+	"pro": true, "max": true, "plus": true, "mini": true, "ultra": true,
+	"lite": true, "se": true, "air": true, "fe": true, "neo": true,
+}
+
+// kinds mark accessories, so that "Чехол для iPhone 15" never joins the
+// iPhone 15 itself.
+var kinds = map[string]string{
+	"чехол": "case", "case": "case", "накладка": "case", "бампер": "case",
+	"стекло": "glass", "glass": "glass", "пленка": "film", "film": "film",
+	"кабель": "cable", "cable": "cable", "зарядка": "charger", "зарядное": "charger",
+	"charger": "charger", "адаптер": "charger", "наушники": "headphones",
+	"ремешок": "strap", "strap": "strap", "держатель": "holder", "holder": "holder",
+}
+
+var stopWords = map[string]bool{
+	"смартфон": true, "телефон": true, "мобильный": true, "новый": true,
+	"smartphone": true, "phone": true, "цвет": true, "color": true,
+	"и": true, "с": true, "для": true, "в": true, "на": true, "with": true, "and": true,
+	"гб": true, "gb": true, "тб": true, "tb": true,
+}
+
+var (
+	memoryPattern  = regexp.MustCompile(`(\d+)\s*/\s*(\d+)\s*(gb|гб|tb|тб)?`)
+	decimalPattern = regexp.MustCompile(`\d+[.,]\d+`)
+)
+
+type features struct {
+	kind      string
+	brand     string
+	storage   int
+	color     string
+	numbers   []string
+	modifiers []string
+	tokens    []string
+}
+
+// Group clusters products that describe the same item. Clusters keep the order
+// in which their first offer appears in products, so the caller's sort order is
+// preserved; offers inside a cluster are ordered by price.
+func Group(products []product.Product) []Cluster {
+	var (
+		clusters []Cluster
+		keys     []features
+	)
+	for _, p := range products {
+		f := extract(p.ProductName)
+		best, bestScore := -1, 0.0
+		for i, k := range keys {
+			if score, ok := similar(f, k); ok && score > bestScore {
+				best, bestScore = i, score
+			}
+		}
+		if best == -1 {
+			key := f.key()
+			if len(f.tokens) == 0 && len(f.numbers) == 0 {
+				// Such names never match, so only the offer tells their clusters apart.
+				key = strings.TrimSpace(key + " " + p.Key)
+			}
+			keys = append(keys, f)
+			clusters = append(clusters, Cluster{Key: key, Name: p.ProductName})
+			best = len(clusters) - 1
+		}
+		clusters[best].Offers = append(clusters[best].Offers, p)
+	}
+
+	for i := range clusters {
+		c := &clusters[i]
+		slices.SortStableFunc(c.Offers, func(a, b product.Product) int {
+			if d := cmp.Compare(a.DiscountPriceKopecks, b.DiscountPriceKopecks); d != 0 {
+				return d
+			}
+			return strings.Compare(a.Key, b.Key)
+		})
+		c.BestOffer = c.Offers[0]
+		c.BestPrice = c.BestOffer.DiscountPriceKopecks
+		for _, offer := range c.Offers {
+			if !slices.Contains(c.Marketplaces, offer.Marketplace) {
+				c.Marketplaces = append(c.Marketplaces, offer.Marketplace)
+			}
+		}
+		slices.Sort(c.Marketplaces)
+	}
+	return clusters
+}
+
+func similar(a, b features) (float64, bool) {
+	if a.kind != b.kind {
+		return 0, false
+	}
+	if a.brand != "" && b.brand != "" && a.brand != b.brand {
+		return 0, false
+	}
+	if a.storage != 0 && b.storage != 0 && a.storage != b.storage {
+		return 0, false
+	}
+	if a.color != "" && b.color != "" && a.color != b.color {
+		return 0, false
+	}
+	if !subset(a.numbers, b.numbers) && !subset(b.numbers, a.numbers) {
+		return 0, false
+	}
+	if !slices.Equal(a.modifiers, b.modifiers) {
+		return 0, false
+	}
+	if len(a.tokens) == 0 && len(b.tokens) == 0 {
+		return 1, len(a.numbers) > 0
+	}
+
+	var common int
+	for _, t := range a.tokens {
+		if slices.Contains(b.tokens, t) {
+			common++
+		}
+	}
+	score := float64(common) / float64(len(a.tokens)+len(b.tokens)-common)
+	return score, score >= minSimilarity
+}
+
+// subset reports whether every element of a is in b. Marketplaces often add
+// article numbers or years to a name, so numbers of the shorter name only have
+// to be present in the longer one.
+func subset(a, b []string) bool {
+	for _, v := range a {
+		if !slices.Contains(b, v) {
+			return false
+		}
+	}
+	return true
+}
+
+func (f features) key() string {
+	parts := []string{f.kind, f.brand}
+	parts = append(parts, f.tokens...)
+	parts = append(parts, f.numbers...)
+	parts = append(parts, f.modifiers...)
+	if f.storage != 0 {
+		parts = append(parts, strconv.Itoa(f.storage)+"gb")
+	}
+	parts = append(parts, f.color)
+	return strings.Join(strings.Fields(strings.Join(parts, " ")), " ")
+}
+
+func extract(name string) features {
+	var f features
+	name = strings.ToLower(name)
+	// "8/256 ГБ" is RAM and storage; the RAM size is not a model number.
+	if m := memoryPattern.FindStringSubmatchIndex(name); m != nil {
+		f.storage = atoi(name[m[4]:m[5]])
+		if m[6] != -1 {
+			if multiplier, ok := storageUnit(name[m[6]:m[7]]); ok {
+				f.storage *= multiplier
+			}
+		}
+		name = name[:m[0]] + " " + name[m[1]:]
+	}
+	// Decimal numbers are screen sizes or versions rather than model numbers.
+	name = decimalPattern.ReplaceAllString(name, " ")
+	tokens := tokenize(name)
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		switch {
+		case isNumber(t):
+			if i+1 < len(tokens) {
+				if multiplier, ok := storageUnit(tokens[i+1]); ok {
+					f.storage = atoi(t) * multiplier
+					i++
+					continue
+				}
+			}
+			if !slices.Contains(f.numbers, t) {
+				f.numbers = append(f.numbers, t)
+			}
+		case brands[t] != "":
+			if f.brand == "" {
+				f.brand = brands[t]
+			}
+		case colors[t] != "":
+			if f.color == "" {
+				f.color = colors[t]
+			}
+		case kinds[t] != "":
+			if f.kind == "" {
+				f.kind = kinds[t]
+			}
+		case modifiers[t]:
+			if !slices.Contains(f.modifiers, t) {
+				f.modifiers = append(f.modifiers, t)
+			}
+		case stopWords[t]:
+		default:
+			if !slices.Contains(f.tokens, t) {
+				f.tokens = append(f.tokens, t)
+			}
+		}
+	}
+	slices.Sort(f.numbers)
+	slices.Sort(f.modifiers)
+	slices.Sort(f.tokens)
+	return f
+}
+
+// tokenize lowercases name and splits it on punctuation and on boundaries
+// between letters and digits, so "iPhone15 128GB" becomes
+// "iphone 15 128 gb".
+func tokenize(name string) []string {
+	name = strings.ReplaceAll(strings.ToLower(name), "ё", "е")
+	var (
+		tokens  []string
+		current strings.Builder
+		digits  bool
+	)
+	flush := func() {
+		if current.Len() > 0 {
+			tokens = append(tokens, current.String())
+			current.Reset()
+		}
+	}
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			flush()
+			continue
+		}
+		isDigit := unicode.IsDigit(r)
+		if current.Len() > 0 && isDigit != digits {
+			flush()
+		}
+		digits = isDigit
+		current.WriteRune(r)
+	}
+	flush()
+	return tokens
+}
+
+func storageUnit(token string) (int, bool) {
+	switch token {
+	case "gb", "гб":
+		return 1, true
+	case "tb", "тб":
+		return 1024, true
+	default:
+		return 0, false
+	}
+}
+
+func isNumber(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+func atoi(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
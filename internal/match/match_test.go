@@ -0,0 +1,83 @@
+package match
+
+import (
+	"testing"
+
+	"agregator/internal/product"
+)
+
+func TestGroupMatchesOffersAcrossMarketplaces(t *testing.T) {
+	products := []product.Product{
+		{Key: "wb:1", Marketplace: "wb", ProductName: "Apple iPhone15 128GB Black", DiscountPriceKopecks: 6_100_000},
+		{Key: "ozon:1", Marketplace: "ozon", ProductName: "Смартфон Apple iPhone 15 128 ГБ, чёрный (A3090)", DiscountPriceKopecks: 5_900_000},
+		{Key: "ozon:2", Marketplace: "ozon", ProductName: "Смартфон Apple iPhone 15 Pro 128 ГБ, черный", DiscountPriceKopecks: 9_000_000},
+		{Key: "wb:2", Marketplace: "wb", ProductName: "Apple iPhone 15 256GB Black", DiscountPriceKopecks: 7_000_000},
+		{Key: "wb:3", Marketplace: "wb", ProductName: "Чехол для Apple iPhone 15, черный", DiscountPriceKopecks: 50_000},
+		{Key: "ozon:3", Marketplace: "ozon", ProductName: "Смартфон Xiaomi Redmi Note 13 8/256 ГБ, 6.67\", черный", DiscountPriceKopecks: 2_000_000},
+		{Key: "wb:4", Marketplace: "wb", ProductName: "Redmi Note 13 256GB черный", DiscountPriceKopecks: 1_900_000},
+	}
+
+	clusters := Group(products)
+	if len(clusters) != 5 {
+		for _, c := range clusters {
+			t.Logf("%s: %d offers", c.Key, len(c.Offers))
+		}
+		t.Fatalf("Group() returned %d clusters, want 5", len(clusters))
+	}
+
+	iphone := clusters[0]
+	if len(iphone.Offers) != 2 || iphone.BestOffer.Key != "ozon:1" || iphone.BestPrice != 5_900_000 {
+		t.Fatalf("iPhone cluster = %#v", iphone)
+	}
+	if len(iphone.Marketplaces) != 2 || iphone.Marketplaces[0] != "ozon" || iphone.Marketplaces[1] != "wb" {
+		t.Fatalf("Marketplaces = %v", iphone.Marketplaces)
+	}
+	if iphone.Key != "apple iphone 15 128gb black" {
+		t.Fatalf("Key = %q", iphone.Key)
+	}
+
+	redmi := clusters[4]
+	if len(redmi.Offers) != 2 || redmi.BestOffer.Key != "wb:4" {
+		t.Fatalf("Redmi cluster = %#v", redmi)
+	}
+}
+
+func TestGroupSplitsDifferentProducts(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		same bool
+	}{
+		{name: "phone and case", a: "Apple iPhone 15 128GB черный", b: "Чехол для Apple iPhone 15 черный"},
+		{name: "case and glass", a: "Чехол для iPhone 15", b: "Защитное стекло для iPhone 15"},
+		{name: "two cases", a: "Чехол для Apple iPhone 15", b: "Чехол-накладка Apple iPhone 15", same: true},
+		{name: "pro", a: "Apple iPhone 15 128GB", b: "Apple iPhone 15 Pro 128GB"},
+		{name: "pro max", a: "Apple iPhone 15 Pro 256GB", b: "Apple iPhone 15 Pro Max 256GB"},
+		{name: "plus", a: "Apple iPhone 15 128GB", b: "Apple iPhone 15 Plus 128GB"},
+		{name: "same modifiers", a: "Apple iPhone 15 Pro Max 256GB", b: "Смартфон Apple iPhone 15 Pro Max 256 ГБ", same: true},
+		{name: "colour", a: "Apple iPhone 15 128GB черный", b: "Apple iPhone 15 128GB white"},
+		{name: "colour in one name", a: "Apple iPhone 15 128GB", b: "Apple iPhone 15 128GB синий", same: true},
+		{name: "storage", a: "Apple iPhone 15 128GB", b: "Apple iPhone 15 256 ГБ"},
+		{name: "storage in terabytes", a: "Apple iPhone 15 Pro 1TB", b: "Apple iPhone 15 Pro 1024GB", same: true},
+		{name: "ram and storage", a: "Xiaomi Redmi Note 13 8/256 ГБ", b: "Xiaomi Redmi Note 13 8/128 ГБ"},
+		{name: "model numbers", a: "Samsung Galaxy A15", b: "Samsung Galaxy A25"},
+		{name: "brand", a: "Xiaomi 14 256GB", b: "Honor 14 256GB"},
+		{name: "no model tokens", a: "Чехол Samsung черный", b: "Чехол Samsung, черный"},
+		{name: "no model tokens in equal names", a: "Кабель Apple", b: "Кабель Apple"},
+		{name: "only numbers", a: "Samsung 55", b: "Samsung 55", same: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clusters := Group([]product.Product{
+				{Key: "wb:1", Marketplace: "wb", ProductName: tt.a},
+				{Key: "ozon:1", Marketplace: "ozon", ProductName: tt.b},
+			})
+			if same := len(clusters) == 1; same != tt.same {
+				t.Fatalf("grouped into %d clusters, want same = %v", len(clusters), tt.same)
+			}
+			if len(clusters) == 2 && clusters[0].Key == clusters[1].Key {
+				t.Fatalf("both clusters have key %q", clusters[0].Key)
+			}
+		})
+	}
+}
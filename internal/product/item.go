@@ -8,15 +8,45 @@ import (
 )
 
 type Product struct {
-	Link                 string `json:"product_url"`
-	IMG                  string `json:"image_url"`
-	ProductID            string `json:"product_id"`
-	ProductName          string `json:"product_name"`
-	DiscountPriceKopecks int64  `json:"product_discount_price"`
-	BasePriceKopecks     int64  `json:"product_base_price"`
-	ProductStatistic     string `json:"product_statistic"`
-	ProductStars         string `json:"product_stars"`
-	ProductReviews       string `json:"product_reviews"`
+	Marketplace          string      `json:"marketplace"`
+	Key                  string      `json:"product_key"`
+	Link                 string      `json:"product_url"`
+	IMG                  string      `json:"image_url"`
+	ProductID            string      `json:"product_id"`
+	ProductName          string      `json:"product_name"`
+	DiscountPriceKopecks int64       `json:"product_discount_price"`
+	BasePriceKopecks     int64       `json:"product_base_price"`
+	ProductStatistic     string      `json:"product_statistic"`
+	ProductStars         string      `json:"product_stars"`
+	ProductReviews       string      `json:"product_reviews"`
+	PriceCheck           *PriceCheck `json:"price_check,omitempty"`
+}
+
+// Verdicts of PriceCheck.
+const (
+	VerdictUnknown = "unknown"
+	VerdictReal    = "real"
+	VerdictRegular = "regular"
+	VerdictFake    = "fake"
+)
+
+// PriceCheck compares the current price of an offer with its recent history.
+// The verdict is "real" when the price is below the median, "fake" when the
+// marketplace shows a discount from a base price that was never charged and
+// the price is not below the median, "regular" otherwise and "unknown" when
+// there is too little history.
+type PriceCheck struct {
+	Verdict            string `json:"verdict"`
+	MedianPriceKopecks int64  `json:"median_price,omitempty"`
+	Observations       int    `json:"observations"`
+	BelowMedian        bool   `json:"below_median"`
+	BasePriceCharged   bool   `json:"base_price_charged"`
+}
+
+// Key returns an identifier that is unique across marketplaces, because product
+// IDs of different stores may coincide.
+func Key(marketplace, productID string) string {
+	return marketplace + ":" + productID
 }
 
 func ParsePrice(value string) (int64, error) {
@@ -61,3 +91,73 @@ func ParsePrice(value string) (int64, error) {
 	}
 	return rubles*100 + kopecks, nil
 }
+
+// FormatPrice formats kopecks the way the web interface does with
+// Intl.NumberFormat('ru-RU', {style: 'currency', currency: 'RUB'}): rubles
+// grouped by thousands with no-break spaces, kopecks only when not zero and
+// without a trailing zero, e.g. "49 990 ₽" or "1 234,5 ₽". Zero gives "".
+func FormatPrice(kopecks int64) string {
+	if kopecks == 0 {
+		return ""
+	}
+	sign := ""
+	if kopecks < 0 {
+		sign, kopecks = "-", -kopecks
+	}
+	digits := strconv.FormatInt(kopecks/100, 10)
+	var rubles strings.Builder
+	for i, digit := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			rubles.WriteRune('\u00a0')
+		}
+		rubles.WriteRune(digit)
+	}
+	fraction := ""
+	if rest := kopecks % 100; rest != 0 {
+		fraction = "," + strings.TrimSuffix(fmt.Sprintf("%02d", rest), "0")
+	}
+	return sign + rubles.String() + fraction + "\u00a0₽"
+}
+
+// Rating parses ProductStars, which marketplaces format with either a comma or
+// a dot as decimal separator.
+func (p Product) Rating() (float64, bool) {
+	value := strings.Replace(strings.TrimSpace(p.ProductStars), ",", ".", 1)
+	rating, err := strconv.ParseFloat(value, 64)
+	if err != nil || rating < 0 {
+		return 0, false
+	}
+	return rating, true
+}
+
+// ReviewCount parses the leading number of ProductReviews, e.g. "1 234 отзыва".
+func (p Product) ReviewCount() (int64, bool) {
+	var digits strings.Builder
+	for _, r := range strings.TrimSpace(p.ProductReviews) {
+		if r >= '0' && r <= '9' {
+			digits.WriteRune(r)
+			continue
+		}
+		if unicode.IsSpace(r) && digits.Len() > 0 {
+			continue
+		}
+		break
+	}
+	if digits.Len() == 0 {
+		return 0, false
+	}
+	count, err := strconv.ParseInt(digits.String(), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return count, true
+}
+
+// DiscountPercent compares the discount price with the base price and returns
+// zero when the marketplace did not report a higher base price.
+func (p Product) DiscountPercent() float64 {
+	if p.BasePriceKopecks <= 0 || p.DiscountPriceKopecks <= 0 || p.DiscountPriceKopecks >= p.BasePriceKopecks {
+		return 0
+	}
+	return float64(p.BasePriceKopecks-p.DiscountPriceKopecks) * 100 / float64(p.BasePriceKopecks)
+}
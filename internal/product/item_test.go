@@ -36,3 +36,65 @@ func TestParsePrice(t *testing.T) {
 		})
 	}
 }
+
+func TestFormatPrice(t *testing.T) {
+	for kopecks, want := range map[int64]string{
+		0:           "",
+		100:         "1\u00a0₽",
+		4_999_000:   "49\u00a0990\u00a0₽",
+		123_450:     "1\u00a0234,5\u00a0₽",
+		1_005:       "10,05\u00a0₽",
+		123_456_789: "1\u00a0234\u00a0567,89\u00a0₽",
+	} {
+		if got := FormatPrice(kopecks); got != want {
+			t.Errorf("FormatPrice(%d) = %q, want %q", kopecks, got, want)
+		}
+	}
+}
+
+func TestRatingAndReviewCount(t *testing.T) {
+	tests := []struct {
+		name        string
+		product     Product
+		wantRating  float64
+		wantReviews int64
+		wantOK      bool
+	}{
+		{name: "ozon", product: Product{ProductStars: "4,8", ProductReviews: "1 234 отзыва"}, wantRating: 4.8, wantReviews: 1_234, wantOK: true},
+		{name: "wb", product: Product{ProductStars: "4.6", ProductReviews: "12"}, wantRating: 4.6, wantReviews: 12, wantOK: true},
+		{name: "missing", product: Product{}, wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rating, ratingOK := tt.product.Rating()
+			reviews, reviewsOK := tt.product.ReviewCount()
+			if ratingOK != tt.wantOK || reviewsOK != tt.wantOK {
+				t.Fatalf("Rating() ok = %v, ReviewCount() ok = %v, want %v", ratingOK, reviewsOK, tt.wantOK)
+			}
+			if rating != tt.wantRating || reviews != tt.wantReviews {
+				t.Fatalf("Rating() = %v, ReviewCount() = %d", rating, reviews)
+			}
+		})
+	}
+}
+
+func TestDiscountPercent(t *testing.T) {
+	tests := []struct {
+		name    string
+		product Product
+		want    float64
+	}{
+		{name: "discount", product: Product{DiscountPriceKopecks: 75_000, BasePriceKopecks: 100_000}, want: 25},
+		{name: "no base price", product: Product{DiscountPriceKopecks: 75_000}, want: 0},
+		{name: "base price below current", product: Product{DiscountPriceKopecks: 75_000, BasePriceKopecks: 50_000}, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.product.DiscountPercent(); got != tt.want {
+				t.Fatalf("DiscountPercent() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
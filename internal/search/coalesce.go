@@ -0,0 +1,176 @@
+package search
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// fetchTimeout bounds a shared fetch. It is detached from the request that
+// started it, so that other requests waiting for the same query still get the
+// answer when that client disconnects.
+const fetchTimeout = 2 * time.Minute
+
+// Locker coordinates fetches of the same query between replicas. TryLock
+// reports false when another replica holds the lock.
+type Locker interface {
+	TryLock(ctx context.Context, key string, ttl time.Duration) (unlock func(), ok bool, err error)
+}
+
+// flight is a fetch shared by every request for the same query. Results of the
+// marketplaces are kept, so requests that join late replay them.
+type flight struct {
+	mu      sync.Mutex
+	results []sourceResult
+	changed chan struct{}
+	waiters int
+	done    bool
+	entry   Entry
+	err     error
+}
+
+func newFlight() *flight {
+	return &flight{changed: make(chan struct{})}
+}
+
+func (f *flight) publish(result sourceResult) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.results = append(f.results, result)
+	close(f.changed)
+	f.changed = make(chan struct{})
+}
+
+func (f *flight) finish(entry Entry, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.entry, f.err, f.done = entry, err, true
+	close(f.changed)
+}
+
+// wait calls onResult for every marketplace result and returns the merged
+// entry. It gives up when ctx is done, without affecting the fetch itself.
+func (f *flight) wait(ctx context.Context, onResult func(sourceResult)) (Entry, error) {
+	var seen int
+	for {
+		f.mu.Lock()
+		pending := f.results[seen:]
+		seen = len(f.results)
+		done, changed := f.done, f.changed
+		f.mu.Unlock()
+
+		if onResult != nil {
+			for _, result := range pending {
+				onResult(result)
+			}
+		}
+		if done {
+			return f.entry, f.err
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return Entry{}, ctx.Err()
+		}
+	}
+}
+
+// fetchShared joins the fetch of query that is already in progress or starts a
+// new one.
+func (s *Service) fetchShared(ctx context.Context, query string, onResult func(sourceResult)) (Entry, error) {
+	return s.fetchSince(ctx, query, time.Time{}, onResult)
+}
+
+// fetchSince is fetchShared that does not take results cached by other
+// replicas before since.
+func (s *Service) fetchSince(ctx context.Context, query string, since time.Time, onResult func(sourceResult)) (Entry, error) {
+	s.mu.Lock()
+	f, ok := s.flights[query]
+	if !ok {
+		f = s.startFlight(ctx, query, since)
+	}
+	f.waiters++
+	if f.waiters > 1 {
+		s.logger.Debug("joined search in progress", "query", query, "waiters", f.waiters)
+	}
+	s.mu.Unlock()
+	return f.wait(ctx, onResult)
+}
+
+// startFlight must be called with s.mu held.
+func (s *Service) startFlight(ctx context.Context, query string, since time.Time) *flight {
+	f := newFlight()
+	s.flights[query] = f
+	go s.lead(context.WithoutCancel(ctx), query, since, f)
+	return f
+}
+
+func (s *Service) lead(ctx context.Context, query string, since time.Time, f *flight) {
+	ctx, cancel := context.WithTimeout(ctx, fetchTimeout)
+	defer cancel()
+
+	entry, err := s.fetchExclusive(ctx, query, since, f.publish)
+	f.finish(entry, err)
+
+	s.mu.Lock()
+	delete(s.flights, query)
+	s.mu.Unlock()
+}
+
+// fetchExclusive fetches query while holding the replica lock. When another
+// replica holds it, the result is taken from the cache as soon as that replica
+// stores it.
+func (s *Service) fetchExclusive(ctx context.Context, query string, since time.Time, onResult func(sourceResult)) (Entry, error) {
+	if s.locker == nil {
+		return s.fetchAndStore(ctx, query, onResult)
+	}
+	for {
+		unlock, ok, err := s.locker.TryLock(ctx, query, fetchTimeout)
+		if err != nil {
+			s.logger.Warn("acquire search lock", "query", query, "error", err)
+			return s.fetchAndStore(ctx, query, onResult)
+		}
+		if ok {
+			defer unlock()
+			// Another replica may have stored the result after our cache miss.
+			if entry, ok := s.storedSince(ctx, query, since); ok {
+				return replay(entry, onResult)
+			}
+			return s.fetchAndStore(ctx, query, onResult)
+		}
+
+		s.logger.Debug("search in progress on another replica", "query", query)
+		select {
+		case <-time.After(s.lockPoll):
+		case <-ctx.Done():
+			return Entry{}, ctx.Err()
+		}
+		if entry, ok := s.storedSince(ctx, query, since); ok {
+			return replay(entry, onResult)
+		}
+	}
+}
+
+// storedSince returns the fresh cached entry of query if it was fetched after
+// since.
+func (s *Service) storedSince(ctx context.Context, query string, since time.Time) (Entry, bool) {
+	entry, state := s.cached(ctx, query)
+	return entry, state == fresh && !entry.FetchedAt.Before(since)
+}
+
+// replay reports a cached entry as if its marketplaces had just answered.
+func replay(entry Entry, onResult func(sourceResult)) (Entry, error) {
+	for _, source := range entry.Sources {
+		result := sourceResult{source: source}
+		for _, p := range entry.Products {
+			if p.Marketplace == source.Marketplace {
+				result.products = append(result.products, p)
+			}
+		}
+		onResult(result)
+	}
+	if len(entry.Products) == 0 {
+		return Entry{}, ErrProductsNotFound
+	}
+	return entry, nil
+}
@@ -0,0 +1,169 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"agregator/internal/product"
+)
+
+type countingMarketplace struct {
+	release chan struct{}
+	calls   atomic.Int32
+}
+
+func (m *countingMarketplace) Name() string {
+	return "wb"
+}
+
+func (m *countingMarketplace) Search(ctx context.Context, _ string) ([]product.Product, error) {
+	m.calls.Add(1)
+	select {
+	case <-m.release:
+		return []product.Product{{Key: "wb:1", Marketplace: "wb", DiscountPriceKopecks: 100}}, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// waitForFlight waits until a fetch of query has the given number of waiters.
+func waitForFlight(t *testing.T, service *Service, query string, waiters int) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		service.mu.Lock()
+		f, ok := service.flights[query]
+		ok = ok && f.waiters == waiters
+		service.mu.Unlock()
+		if ok {
+			return
+		}
+	}
+	t.Fatalf("search for %q has no %d waiters", query, waiters)
+}
+
+func TestSearchCoalescesConcurrentQueries(t *testing.T) {
+	marketplace := &countingMarketplace{release: make(chan struct{})}
+	service := New(slog.Default(), nil, marketplace)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := service.Search(context.Background(), " iPhone 15 ", Options{})
+			if err == nil && len(result.Products) != 1 {
+				err = errors.New("unexpected products")
+			}
+			errs <- err
+		}()
+	}
+	waitForFlight(t, service, "iphone 15", 10)
+	close(marketplace.release)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Search() error = %v", err)
+		}
+	}
+	if calls := marketplace.calls.Load(); calls != 1 {
+		t.Fatalf("marketplace calls = %d, want 1", calls)
+	}
+}
+
+func TestSearchSurvivesLeaderCancellation(t *testing.T) {
+	marketplace := &countingMarketplace{release: make(chan struct{})}
+	cache := &fakeCache{getErr: errors.New("cache miss")}
+	service := New(slog.Default(), cache, marketplace)
+
+	leaderCtx, cancelLeader := context.WithCancel(context.Background())
+	leaderErr := make(chan error, 1)
+	go func() {
+		_, err := service.Search(leaderCtx, "phone", Options{})
+		leaderErr <- err
+	}()
+	waitForFlight(t, service, "phone", 1)
+
+	follower := make(chan error, 1)
+	go func() {
+		_, err := service.Search(context.Background(), "phone", Options{})
+		follower <- err
+	}()
+	waitForFlight(t, service, "phone", 2)
+	cancelLeader()
+	if err := <-leaderErr; !errors.Is(err, context.Canceled) {
+		t.Fatalf("leader error = %v, want context.Canceled", err)
+	}
+
+	close(marketplace.release)
+	if err := <-follower; err != nil {
+		t.Fatalf("follower error = %v", err)
+	}
+	if calls := marketplace.calls.Load(); calls != 1 {
+		t.Fatalf("marketplace calls = %d, want 1", calls)
+	}
+	if cache.setCalls != 1 {
+		t.Fatalf("cache Set calls = %d, want 1", cache.setCalls)
+	}
+}
+
+// lockedCache is a cache shared with another replica that is fetching the
+// query: the lock is held until the replica stores its result.
+type lockedCache struct {
+	mu     sync.Mutex
+	entry  *Entry
+	polls  int
+	stored Entry
+}
+
+func (c *lockedCache) Get(context.Context, string) (Entry, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.polls++
+	if c.polls == 3 {
+		c.entry = &c.stored
+	}
+	if c.entry == nil {
+		return Entry{}, errors.New("cache miss")
+	}
+	return *c.entry, nil
+}
+
+func (c *lockedCache) Set(context.Context, string, Entry, time.Duration) error {
+	return nil
+}
+
+func (c *lockedCache) TryLock(context.Context, string, time.Duration) (func(), bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return func() {}, c.entry != nil, nil
+}
+
+func TestSearchWaitsForReplicaHoldingLock(t *testing.T) {
+	cache := &lockedCache{stored: Entry{
+		FetchedAt: time.Now(),
+		Products:  []product.Product{{Key: "wb:1", Marketplace: "wb", DiscountPriceKopecks: 100}},
+		Sources:   []SourceStatus{{Marketplace: "wb", Status: StatusOK, Count: 1}},
+	}}
+	marketplace := &countingMarketplace{release: make(chan struct{})}
+	service := New(slog.Default(), cache, marketplace)
+	service.lockPoll = time.Millisecond
+
+	result, err := service.Search(context.Background(), "phone", Options{})
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	if len(result.Products) != 1 || len(result.Sources) != 1 {
+		t.Fatalf("Search() = %#v", result)
+	}
+	if calls := marketplace.calls.Load(); calls != 0 {
+		t.Fatalf("marketplace calls = %d, want 0", calls)
+	}
+}
@@ -0,0 +1,48 @@
+package search
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	// ErrAllSourcesFailed is returned when no marketplace answered.
+	ErrAllSourcesFailed = errors.New("all marketplaces failed")
+	// ErrSourcesFailed is returned along with ErrProductsNotFound when the
+	// marketplaces that answered found nothing but others failed, so the empty
+	// result is not cached.
+	ErrSourcesFailed = errors.New("some marketplaces failed")
+	// ErrRateLimited is returned by adapters when a marketplace throttles or
+	// blocks the requests.
+	ErrRateLimited = errors.New("marketplace rate limited")
+	// ErrUnavailable is returned by adapters when a marketplace keeps answering
+	// with unexpected statuses.
+	ErrUnavailable = errors.New("marketplace unavailable")
+	// ErrBadResponse is returned by adapters when a response cannot be parsed.
+	ErrBadResponse = errors.New("unexpected marketplace response")
+)
+
+// Error codes describe why a marketplace failed without exposing the upstream
+// error text.
+const (
+	CodeTimeout     = "timeout"
+	CodeCanceled    = "canceled"
+	CodeRateLimited = "rate_limited"
+	CodeBadResponse = "bad_response"
+	CodeUnavailable = "unavailable"
+)
+
+func errorCode(err error) string {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return CodeTimeout
+	case errors.Is(err, context.Canceled):
+		return CodeCanceled
+	case errors.Is(err, ErrRateLimited):
+		return CodeRateLimited
+	case errors.Is(err, ErrBadResponse):
+		return CodeBadResponse
+	default:
+		return CodeUnavailable
+	}
+}
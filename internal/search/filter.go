@@ -0,0 +1,54 @@
+package search
+
+import (
+	"slices"
+
+	"agregator/internal/product"
+)
+
+// Filter narrows a search result. Zero values disable the corresponding check,
+// so the zero Filter keeps every product.
+type Filter struct {
+	MinPriceKopecks int64
+	MaxPriceKopecks int64
+	MinRating       float64
+	MinReviews      int64
+	Marketplaces    []string
+}
+
+func (f Filter) Match(p product.Product) bool {
+	if f.MinPriceKopecks > 0 && p.DiscountPriceKopecks < f.MinPriceKopecks {
+		return false
+	}
+	if f.MaxPriceKopecks > 0 && p.DiscountPriceKopecks > f.MaxPriceKopecks {
+		return false
+	}
+	if f.MinRating > 0 {
+		rating, ok := p.Rating()
+		if !ok || rating < f.MinRating {
+			return false
+		}
+	}
+	if f.MinReviews > 0 {
+		reviews, ok := p.ReviewCount()
+		if !ok || reviews < f.MinReviews {
+			return false
+		}
+	}
+	if len(f.Marketplaces) > 0 && !slices.Contains(f.Marketplaces, p.Marketplace) {
+		return false
+	}
+	return true
+}
+
+// Apply returns the matching products in a new slice and leaves products
+// untouched, because it may be shared with the cache.
+func (f Filter) Apply(products []product.Product) []product.Product {
+	filtered := make([]product.Product, 0, len(products))
+	for _, p := range products {
+		if f.Match(p) {
+			filtered = append(filtered, p)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,6 @@
+package search
+
+import "expvar"
+
+// metrics are published by expvar under "search", e.g. on /debug/vars.
+var metrics = expvar.NewMap("search")
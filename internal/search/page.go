@@ -0,0 +1,95 @@
+package search
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"hash/fnv"
+
+	"agregator/internal/product"
+)
+
+var (
+	ErrInvalidCursor = errors.New("invalid cursor")
+	ErrCursorExpired = errors.New("cursor expired")
+)
+
+type Page struct {
+	Products   []product.Product `json:"products"`
+	Total      int               `json:"total"`
+	NextCursor string            `json:"next_cursor,omitempty"`
+}
+
+type cursor struct {
+	Offset  int    `json:"o"`
+	Version uint64 `json:"v"`
+}
+
+// Paginate returns limit products starting at offset or at the position stored
+// in a cursor from a previous page. The cursor remembers the result set it was
+// issued for and is rejected with ErrCursorExpired once that set changes, e.g.
+// after the cached result was refreshed.
+func Paginate(products []product.Product, limit, offset int, token string) (Page, error) {
+	keys := make([]string, len(products))
+	for i, p := range products {
+		keys[i] = p.Key
+	}
+	start, end, next, err := Window(keys, limit, offset, token)
+	if err != nil {
+		return Page{}, err
+	}
+	return Page{Products: products[start:end], Total: len(products), NextCursor: next}, nil
+}
+
+// Window resolves a page over items identified by keys and returns its bounds
+// and the cursor of the following page, which is empty on the last page.
+func Window(keys []string, limit, offset int, token string) (int, int, string, error) {
+	version := fingerprint(keys)
+	if token != "" {
+		c, err := decodeCursor(token)
+		if err != nil {
+			return 0, 0, "", err
+		}
+		if c.Version != version {
+			return 0, 0, "", ErrCursorExpired
+		}
+		offset = c.Offset
+	}
+	if limit <= 0 || offset < 0 {
+		return 0, 0, "", ErrInvalidCursor
+	}
+
+	start := min(offset, len(keys))
+	end := min(start+limit, len(keys))
+	var next string
+	if end < len(keys) {
+		next = encodeCursor(cursor{Offset: end, Version: version})
+	}
+	return start, end, next, nil
+}
+
+func fingerprint(keys []string) uint64 {
+	hash := fnv.New64a()
+	for _, key := range keys {
+		hash.Write([]byte(key))
+		hash.Write([]byte{0})
+	}
+	return hash.Sum64()
+}
+
+func encodeCursor(c cursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(token string) (cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return cursor{}, ErrInvalidCursor
+	}
+	var c cursor
+	if err := json.Unmarshal(data, &c); err != nil || c.Offset < 0 {
+		return cursor{}, ErrInvalidCursor
+	}
+	return c, nil
+}
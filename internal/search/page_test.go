@@ -0,0 +1,36 @@
+package search
+
+import (
+	"errors"
+	"testing"
+
+	"agregator/internal/product"
+)
+
+func TestPaginateFollowsCursor(t *testing.T) {
+	products := []product.Product{{Key: "wb:1"}, {Key: "wb:2"}, {Key: "ozon:1"}}
+
+	first, err := Paginate(products, 2, 0, "")
+	if err != nil {
+		t.Fatalf("Paginate() error = %v", err)
+	}
+	if len(first.Products) != 2 || first.Total != 3 || first.NextCursor == "" {
+		t.Fatalf("first page = %#v", first)
+	}
+
+	second, err := Paginate(products, 2, 0, first.NextCursor)
+	if err != nil {
+		t.Fatalf("Paginate() error = %v", err)
+	}
+	if len(second.Products) != 1 || second.Products[0].Key != "ozon:1" || second.NextCursor != "" {
+		t.Fatalf("second page = %#v", second)
+	}
+
+	changed := []product.Product{{Key: "wb:1"}, {Key: "ozon:1"}, {Key: "wb:2"}}
+	if _, err := Paginate(changed, 2, 0, first.NextCursor); !errors.Is(err, ErrCursorExpired) {
+		t.Fatalf("Paginate() error = %v, want %v", err, ErrCursorExpired)
+	}
+	if _, err := Paginate(products, 2, 0, "not a cursor"); !errors.Is(err, ErrInvalidCursor) {
+		t.Fatalf("Paginate() error = %v, want %v", err, ErrInvalidCursor)
+	}
+}
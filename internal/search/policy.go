@@ -0,0 +1,136 @@
+package search
+
+import (
+	"context"
+	"time"
+)
+
+// CachePolicy controls how long search results are served from the cache. A
+// result younger than SoftTTL is fresh. Between SoftTTL and HardTTL it is
+// stale: it is still served, but a background refresh is started. Older
+// results are not used.
+//
+// Partial results, where some marketplace failed, are fresh only for
+// PartialTTL, so that the refresh picks up the recovered marketplace early.
+// Empty results are cached for EmptyTTL without a stale period; zero disables
+// caching them.
+type CachePolicy struct {
+	SoftTTL    time.Duration
+	HardTTL    time.Duration
+	PartialTTL time.Duration
+	EmptyTTL   time.Duration
+}
+
+var DefaultCachePolicy = CachePolicy{
+	SoftTTL:    10 * time.Minute,
+	HardTTL:    time.Hour,
+	PartialTTL: 2 * time.Minute,
+	EmptyTTL:   5 * time.Minute,
+}
+
+// SetCachePolicy replaces DefaultCachePolicy. A SoftTTL that is zero or not
+// less than HardTTL disables stale results.
+func (s *Service) SetCachePolicy(policy CachePolicy) {
+	if policy.HardTTL <= 0 {
+		policy.HardTTL = DefaultCachePolicy.HardTTL
+	}
+	if policy.SoftTTL <= 0 || policy.SoftTTL > policy.HardTTL {
+		policy.SoftTTL = policy.HardTTL
+	}
+	if policy.PartialTTL <= 0 || policy.PartialTTL > policy.SoftTTL {
+		policy.PartialTTL = policy.SoftTTL
+	}
+	if policy.EmptyTTL < 0 {
+		policy.EmptyTTL = 0
+	}
+	s.policy = policy
+}
+
+type freshness int
+
+const (
+	missing freshness = iota
+	fresh
+	stale
+)
+
+func (p CachePolicy) freshness(entry Entry) freshness {
+	age := entry.age()
+	if len(entry.Products) == 0 {
+		if age < p.EmptyTTL {
+			return fresh
+		}
+		return missing
+	}
+	soft := p.SoftTTL
+	if entry.partial() {
+		soft = p.PartialTTL
+	}
+	switch {
+	case age < soft:
+		return fresh
+	case age < p.HardTTL:
+		return stale
+	default:
+		return missing
+	}
+}
+
+// ttl is how long the cache keeps entry. Stale entries must outlive the soft
+// TTL to be served.
+func (p CachePolicy) ttl(entry Entry) time.Duration {
+	if len(entry.Products) == 0 {
+		return p.EmptyTTL
+	}
+	return p.HardTTL
+}
+
+// store caches entry according to the policy.
+func (s *Service) store(ctx context.Context, query string, entry Entry) {
+	if s.cache == nil {
+		return
+	}
+	ttl := s.policy.ttl(entry)
+	if ttl <= 0 {
+		return
+	}
+	switch {
+	case len(entry.Products) == 0:
+		metrics.Add("empty_cached", 1)
+		s.logger.Info("caching empty result", "query", query, "ttl", ttl)
+	case entry.partial():
+		metrics.Add("partial_cached", 1)
+		s.logger.Info("caching partial result", "query", query, "fresh_for", s.policy.PartialTTL)
+	}
+	if err := s.cache.Set(ctx, query, entry, ttl); err != nil {
+		s.logger.Warn("save search result to cache", "query", query, "error", err)
+	}
+}
+
+// refresh starts a background fetch of query unless one is in progress. The
+// stale entry stays in the cache if the fetch fails.
+func (s *Service) refresh(ctx context.Context, query string, previous Entry) {
+	s.mu.Lock()
+	_, running := s.flights[query]
+	var f *flight
+	if !running {
+		f = s.startFlight(ctx, query, time.Time{})
+	}
+	s.mu.Unlock()
+	if running {
+		return
+	}
+
+	s.logger.Debug("refreshing stale search result", "query", query)
+	go func() {
+		entry, err := f.wait(context.Background(), nil)
+		if err != nil {
+			s.logger.Warn("background refresh failed", "query", query, "error", err)
+			return
+		}
+		if previous.partial() && !entry.partial() {
+			metrics.Add("partial_upgraded", 1)
+			s.logger.Info("partial result upgraded", "query", query)
+		}
+	}()
+}
@@ -0,0 +1,168 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"log/slog"
+	"testing"
+	"time"
+
+	"agregator/internal/product"
+)
+
+// waitForRefresh waits until no fetch is in progress.
+func waitForRefresh(t *testing.T, service *Service) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		service.mu.Lock()
+		n := len(service.flights)
+		service.mu.Unlock()
+		if n == 0 {
+			return
+		}
+	}
+	t.Fatal("refresh did not finish")
+}
+
+func TestSearchServesStaleResultAndRefreshes(t *testing.T) {
+	cache := &fakeCache{
+		products:  []product.Product{{Key: "wb:old", DiscountPriceKopecks: 500}},
+		fetchedAt: time.Now().Add(-20 * time.Minute),
+	}
+	marketplace := &fakeMarketplace{name: "wb", products: []product.Product{{Key: "wb:new", DiscountPriceKopecks: 400}}}
+	service := New(slog.Default(), cache, marketplace)
+	service.SetCachePolicy(CachePolicy{SoftTTL: 10 * time.Minute, HardTTL: time.Hour})
+
+	result, err := service.Search(context.Background(), "phone", Options{})
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	if !result.Cached || !result.Stale || result.Products[0].Key != "wb:old" {
+		t.Fatalf("Search() = %#v, want stale cached result", result)
+	}
+	if result.AgeSeconds < 1199 || result.AgeSeconds > 1210 {
+		t.Fatalf("AgeSeconds = %d, want about 1200", result.AgeSeconds)
+	}
+
+	waitForRefresh(t, service)
+	if marketplace.calls != 1 || cache.setCalls != 1 || cache.products[0].Key != "wb:new" {
+		t.Fatalf("refresh: calls = %d, Set calls = %d, products = %#v", marketplace.calls, cache.setCalls, cache.products)
+	}
+
+	result, err = service.Search(context.Background(), "phone", Options{})
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	if !result.Cached || result.Stale || result.Products[0].Key != "wb:new" {
+		t.Fatalf("Search() after refresh = %#v", result)
+	}
+}
+
+func TestSearchFetchesExpiredResult(t *testing.T) {
+	cache := &fakeCache{
+		products:  []product.Product{{Key: "wb:old", DiscountPriceKopecks: 500}},
+		fetchedAt: time.Now().Add(-2 * time.Hour),
+	}
+	marketplace := &fakeMarketplace{name: "wb", products: []product.Product{{Key: "wb:new", DiscountPriceKopecks: 400}}}
+	service := New(slog.Default(), cache, marketplace)
+
+	result, err := service.Search(context.Background(), "phone", Options{})
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	if result.Cached || result.Stale || result.AgeSeconds != 0 || result.Products[0].Key != "wb:new" {
+		t.Fatalf("Search() = %#v, want fresh fetch", result)
+	}
+}
+
+func counter(name string) int64 {
+	if v, ok := metrics.Get(name).(*expvar.Int); ok {
+		return v.Value()
+	}
+	return 0
+}
+
+func TestSearchCachesEmptyResult(t *testing.T) {
+	cache := &fakeCache{}
+	marketplace := &fakeMarketplace{name: "wb"}
+	service := New(slog.Default(), cache, marketplace)
+	service.SetCachePolicy(CachePolicy{EmptyTTL: time.Minute})
+	cached, hits := counter("empty_cached"), counter("empty_hits")
+
+	for i := 0; i < 2; i++ {
+		if _, err := service.Search(context.Background(), "junk", Options{}); !errors.Is(err, ErrProductsNotFound) {
+			t.Fatalf("Search() error = %v, want ErrProductsNotFound", err)
+		}
+	}
+	if marketplace.calls != 1 || cache.setCalls != 1 || cache.ttl != time.Minute {
+		t.Fatalf("calls = %d, Set calls = %d, ttl = %v", marketplace.calls, cache.setCalls, cache.ttl)
+	}
+	if counter("empty_cached") != cached+1 || counter("empty_hits") != hits+1 {
+		t.Fatal("empty result metrics not updated")
+	}
+}
+
+func TestSearchDoesNotCacheEmptyResultOfFailedSource(t *testing.T) {
+	cache := &fakeCache{}
+	empty := &fakeMarketplace{name: "wb"}
+	failed := &fakeMarketplace{name: "ozon", err: errors.New("unavailable")}
+	service := New(slog.Default(), cache, empty, failed)
+
+	if _, err := service.Search(context.Background(), "junk", Options{}); !errors.Is(err, ErrProductsNotFound) {
+		t.Fatalf("Search() error = %v, want ErrProductsNotFound", err)
+	}
+	if cache.setCalls != 0 {
+		t.Fatalf("Set calls = %d, want 0", cache.setCalls)
+	}
+}
+
+func TestSearchUpgradesPartialResult(t *testing.T) {
+	cache := &fakeCache{
+		products: []product.Product{{Key: "wb:1", Marketplace: "wb", DiscountPriceKopecks: 500}},
+		sources: []SourceStatus{
+			{Marketplace: "ozon", Status: StatusError, Error: CodeUnavailable},
+			{Marketplace: "wb", Status: StatusOK, Count: 1},
+		},
+		fetchedAt: time.Now().Add(-3 * time.Minute),
+	}
+	ozon := &fakeMarketplace{name: "ozon", products: []product.Product{{Key: "ozon:1", Marketplace: "ozon", DiscountPriceKopecks: 400}}}
+	wb := &fakeMarketplace{name: "wb", products: []product.Product{{Key: "wb:1", Marketplace: "wb", DiscountPriceKopecks: 500}}}
+	service := New(slog.Default(), cache, ozon, wb)
+	service.SetCachePolicy(CachePolicy{SoftTTL: 10 * time.Minute, HardTTL: time.Hour, PartialTTL: 2 * time.Minute})
+	upgraded := counter("partial_upgraded")
+
+	result, err := service.Search(context.Background(), "phone", Options{})
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	if !result.Partial || !result.Stale {
+		t.Fatalf("Search() = %#v, want stale partial result", result)
+	}
+
+	waitForRefresh(t, service)
+	for deadline := time.Now().Add(time.Second); counter("partial_upgraded") == upgraded && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	if counter("partial_upgraded") != upgraded+1 {
+		t.Fatal("partial_upgraded not incremented")
+	}
+	if len(cache.products) != 2 || cache.ttl != time.Hour {
+		t.Fatalf("cached products = %d, ttl = %v", len(cache.products), cache.ttl)
+	}
+}
+
+func TestSetCachePolicy(t *testing.T) {
+	service := New(slog.Default(), nil)
+	service.SetCachePolicy(CachePolicy{SoftTTL: 2 * time.Hour, HardTTL: time.Hour})
+	if service.policy.SoftTTL != time.Hour {
+		t.Fatalf("SoftTTL = %v, want it capped by HardTTL", service.policy.SoftTTL)
+	}
+	service.SetCachePolicy(CachePolicy{})
+	if service.policy.HardTTL != DefaultCachePolicy.HardTTL || service.policy.SoftTTL != DefaultCachePolicy.HardTTL {
+		t.Fatalf("policy = %#v", service.policy)
+	}
+	if service.policy.PartialTTL != service.policy.SoftTTL || service.policy.EmptyTTL != 0 {
+		t.Fatalf("policy = %#v, want partial and empty results treated as usual", service.policy)
+	}
+}
@@ -0,0 +1,40 @@
+package search
+
+import (
+	"context"
+	"time"
+
+	"agregator/internal/product"
+)
+
+// PriceChecker judges discounts by the price history of offers recorded
+// before the given time, so that the current fetch does not vote for itself.
+// The result is keyed by product.Key.
+type PriceChecker interface {
+	CheckPrices(ctx context.Context, products []product.Product, before time.Time) (map[string]product.PriceCheck, error)
+}
+
+// SetPriceChecker makes the service annotate the products it returns with
+// product.PriceCheck.
+func (s *Service) SetPriceChecker(checker PriceChecker) {
+	s.checker = checker
+}
+
+// checkPrices sets PriceCheck on products, which must not be shared with the
+// cache. Without history the products are returned as is.
+func (s *Service) checkPrices(ctx context.Context, products []product.Product, before time.Time) []product.Product {
+	if s.checker == nil || len(products) == 0 {
+		return products
+	}
+	checks, err := s.checker.CheckPrices(ctx, products, before)
+	if err != nil {
+		s.logger.Warn("check prices failed", "error", err)
+		return products
+	}
+	for i, p := range products {
+		if check, ok := checks[product.Key(p.Marketplace, p.ProductID)]; ok {
+			products[i].PriceCheck = &check
+		}
+	}
+	return products
+}
@@ -8,6 +8,7 @@ import (
 	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"agregator/internal/product"
 )
@@ -15,88 +16,286 @@ import (
 var ErrProductsNotFound = errors.New("products not found")
 
 type Marketplace interface {
+	Name() string
 	Search(ctx context.Context, query string) ([]product.Product, error)
 }
 
+// Entry is the cached result of a query together with the state of every
+// marketplace at the time it was fetched.
+type Entry struct {
+	Products  []product.Product `json:"products"`
+	Sources   []SourceStatus    `json:"sources"`
+	FetchedAt time.Time         `json:"fetched_at"`
+}
+
+func (e Entry) partial() bool {
+	for _, source := range e.Sources {
+		if source.Status != StatusOK {
+			return true
+		}
+	}
+	return false
+}
+
 type Cache interface {
-	Get(ctx context.Context, query string) ([]product.Product, error)
-	Set(ctx context.Context, query string, products []product.Product) error
+	Get(ctx context.Context, query string) (Entry, error)
+	Set(ctx context.Context, query string, entry Entry, ttl time.Duration) error
+}
+
+// Recorder receives the products of every marketplace fetch, for example to
+// keep their price history. Results served from the cache are not recorded.
+type Recorder interface {
+	Record(ctx context.Context, products []product.Product, at time.Time) error
+}
+
+// FetchObserver is told how every marketplace answered each fetch, including
+// fetches where all of them failed.
+type FetchObserver interface {
+	Fetched(ctx context.Context, query string, sources []SourceStatus)
+}
+
+// Result is the answer to a search. Partial is set when at least one
+// marketplace failed, so the products may be incomplete. Stale is set when a
+// cached result is older than the soft TTL and is being refreshed.
+type Result struct {
+	Products   []product.Product `json:"products"`
+	Sources    []SourceStatus    `json:"sources"`
+	Partial    bool              `json:"partial"`
+	Cached     bool              `json:"cached"`
+	CachedAt   *time.Time        `json:"cached_at,omitempty"`
+	Stale      bool              `json:"stale"`
+	AgeSeconds int64             `json:"age_seconds"`
 }
 
 type Service struct {
 	cache        Cache
+	locker       Locker
 	marketplaces []Marketplace
 	logger       *slog.Logger
+	policy       CachePolicy
+	recorder     Recorder
+	checker      PriceChecker
+	observer     FetchObserver
+
+	mu       sync.Mutex
+	flights  map[string]*flight
+	lockPoll time.Duration
 }
 
+// New creates a search service. If cache also implements Locker, fetches of the
+// same query are coordinated between replicas that share the cache.
 func New(logger *slog.Logger, cache Cache, marketplaces ...Marketplace) *Service {
-	return &Service{logger: logger, cache: cache, marketplaces: marketplaces}
+	s := &Service{
+		logger:       logger,
+		cache:        cache,
+		marketplaces: marketplaces,
+		policy:       DefaultCachePolicy,
+		flights:      make(map[string]*flight),
+		lockPoll:     500 * time.Millisecond,
+	}
+	if locker, ok := cache.(Locker); ok {
+		s.locker = locker
+	}
+	return s
+}
+
+// SetRecorder makes the service pass every fetched result to recorder.
+func (s *Service) SetRecorder(recorder Recorder) {
+	s.recorder = recorder
 }
 
-func (s *Service) Search(ctx context.Context, query string) ([]product.Product, error) {
-	query = normalizeQuery(query)
-	if s.cache != nil {
-		products, err := s.cache.Get(ctx, query)
-		if err == nil {
-			s.logger.Debug("cache hit", "query", query, "products", len(products))
-			return products, nil
+// SetFetchObserver makes the service report the marketplace statuses of every
+// fetch to observer.
+func (s *Service) SetFetchObserver(observer FetchObserver) {
+	s.observer = observer
+}
+
+// Marketplaces returns the names of the configured marketplaces.
+func (s *Service) Marketplaces() []string {
+	names := make([]string, 0, len(s.marketplaces))
+	for _, m := range s.marketplaces {
+		names = append(names, m.Name())
+	}
+	return names
+}
+
+type Options struct {
+	Filter Filter
+	Sort   SortOrder
+}
+
+func (o Options) apply(products []product.Product, query string) []product.Product {
+	products = o.Filter.Apply(products)
+	Sort(products, o.Sort, query)
+	return products
+}
+
+// Search returns the products matching the options. The full result of a query
+// is cached, so different filters and sort orders for the same query share one
+// marketplace fetch.
+func (s *Service) Search(ctx context.Context, query string, options Options) (Result, error) {
+	query = NormalizeQuery(query)
+	entry, state := s.cached(ctx, query)
+	switch state {
+	case missing:
+		var err error
+		entry, err = s.fetchShared(ctx, query, nil)
+		if err != nil {
+			return Result{}, err
 		}
+	case stale:
+		s.refresh(ctx, query, entry)
+	}
+	if len(entry.Products) == 0 {
+		return Result{}, ErrProductsNotFound
+	}
+
+	cached := state != missing
+	result := Result{
+		Products: s.checkPrices(ctx, options.apply(entry.Products, query), entry.FetchedAt),
+		Sources:  entry.Sources,
+		Partial:  entry.partial(),
+		Cached:   cached,
+		Stale:    state == stale,
+	}
+	if cached {
+		result.CachedAt = &entry.FetchedAt
+		result.AgeSeconds = int64(entry.age().Seconds())
+	}
+	return result, nil
+}
+
+func (e Entry) age() time.Duration {
+	return time.Since(e.FetchedAt)
+}
+
+// cached returns the cached entry of query and whether it is fresh or stale.
+// Entries without FetchedAt predate the metadata and are ignored.
+func (s *Service) cached(ctx context.Context, query string) (Entry, freshness) {
+	if s.cache == nil {
+		return Entry{}, missing
+	}
+	entry, err := s.cache.Get(ctx, query)
+	if err != nil {
+		metrics.Add("cache_misses", 1)
 		s.logger.Debug("cache unavailable", "query", query, "error", err)
+		return Entry{}, missing
+	}
+	state := missing
+	if !entry.FetchedAt.IsZero() {
+		state = s.policy.freshness(entry)
 	}
+	switch {
+	case state == missing:
+		metrics.Add("cache_misses", 1)
+		return Entry{}, missing
+	case len(entry.Products) == 0:
+		metrics.Add("empty_hits", 1)
+	case state == stale:
+		metrics.Add("cache_stale_hits", 1)
+	default:
+		metrics.Add("cache_hits", 1)
+	}
+	if entry.Sources == nil {
+		entry.Sources = []SourceStatus{}
+	}
+	s.logger.Debug("cache hit", "query", query, "products", len(entry.Products), "stale", state == stale)
+	return entry, state
+}
 
-	products, errs := s.fetch(ctx, query)
-	if len(products) == 0 {
+// fetchAndStore queries every marketplace, calling onResult as soon as each of
+// them answers, and caches the merged result according to the cache policy.
+func (s *Service) fetchAndStore(ctx context.Context, query string, onResult func(sourceResult)) (Entry, error) {
+	entry, errs := s.fetch(ctx, query, onResult)
+	if s.observer != nil {
+		s.observer.Fetched(ctx, query, entry.Sources)
+	}
+	if len(entry.Products) == 0 {
 		if len(errs) == len(s.marketplaces) {
-			return nil, fmt.Errorf("search marketplaces: %w", errors.Join(errs...))
+			return Entry{}, fmt.Errorf("%w: %w", ErrAllSourcesFailed, errors.Join(errs...))
+		}
+		// Only an answer of every marketplace proves that nothing was found.
+		if len(errs) > 0 {
+			return Entry{}, fmt.Errorf("%w: %w: %w", ErrProductsNotFound, ErrSourcesFailed, errors.Join(errs...))
 		}
-		return nil, ErrProductsNotFound
+		s.store(ctx, query, entry)
+		return Entry{}, ErrProductsNotFound
 	}
 	for _, err := range errs {
 		s.logger.Warn("marketplace search failed", "query", query, "error", err)
 	}
 
-	sort.Slice(products, func(i, j int) bool {
-		return products[i].DiscountPriceKopecks < products[j].DiscountPriceKopecks
-	})
+	s.store(ctx, query, entry)
+	s.record(ctx, query, entry)
+	return entry, nil
+}
 
-	if s.cache != nil {
-		if err := s.cache.Set(ctx, query, products); err != nil {
-			s.logger.Warn("save search result to cache", "query", query, "error", err)
-		}
+func (s *Service) record(ctx context.Context, query string, entry Entry) {
+	if s.recorder == nil {
+		return
+	}
+	if err := s.recorder.Record(ctx, entry.Products, entry.FetchedAt); err != nil {
+		s.logger.Warn("record prices failed", "query", query, "error", err)
 	}
-	return products, nil
 }
 
-func (s *Service) fetch(ctx context.Context, query string) ([]product.Product, []error) {
-	type result struct {
-		products []product.Product
-		err      error
+type sourceResult struct {
+	products []product.Product
+	err      error
+	source   SourceStatus
+}
+
+func newSourceResult(marketplace string, products []product.Product, err error, latency time.Duration) sourceResult {
+	source := SourceStatus{
+		Marketplace: marketplace,
+		Status:      StatusOK,
+		Count:       len(products),
+		LatencyMS:   latency.Milliseconds(),
+	}
+	if err != nil {
+		source.Status = StatusError
+		source.Error = errorCode(err)
+		if source.Error == CodeTimeout {
+			source.Status = StatusTimeout
+		}
 	}
+	return sourceResult{products: products, err: err, source: source}
+}
 
-	results := make(chan result, len(s.marketplaces))
-	var wg sync.WaitGroup
+func (s *Service) fetch(ctx context.Context, query string, onResult func(sourceResult)) (Entry, []error) {
+	results := make(chan sourceResult, len(s.marketplaces))
 	for _, marketplace := range s.marketplaces {
-		wg.Add(1)
 		go func(m Marketplace) {
-			defer wg.Done()
+			started := time.Now()
 			products, err := m.Search(ctx, query)
-			results <- result{products: products, err: err}
+			if err != nil {
+				err = fmt.Errorf("%s: %w", m.Name(), err)
+			}
+			results <- newSourceResult(m.Name(), products, err, time.Since(started))
 		}(marketplace)
 	}
-	wg.Wait()
-	close(results)
 
-	var products []product.Product
+	entry := Entry{Sources: make([]SourceStatus, 0, len(s.marketplaces))}
 	var errs []error
-	for result := range results {
-		products = append(products, result.products...)
+	for range s.marketplaces {
+		result := <-results
+		if onResult != nil {
+			onResult(result)
+		}
+		entry.Products = append(entry.Products, result.products...)
+		entry.Sources = append(entry.Sources, result.source)
 		if result.err != nil {
 			errs = append(errs, result.err)
 		}
 	}
-	return products, errs
+	sort.Slice(entry.Sources, func(i, j int) bool {
+		return entry.Sources[i].Marketplace < entry.Sources[j].Marketplace
+	})
+	entry.FetchedAt = time.Now()
+	return entry, errs
 }
 
-func normalizeQuery(query string) string {
+// NormalizeQuery returns the form of query used as the cache key.
+func NormalizeQuery(query string) string {
 	return strings.ToLower(strings.Join(strings.Fields(query), " "))
 }
@@ -3,50 +3,65 @@ package search
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log/slog"
+	"strings"
 	"testing"
+	"time"
 
 	"agregator/internal/product"
 )
 
 type fakeMarketplace struct {
+	name     string
 	products []product.Product
 	err      error
 	calls    int
 }
 
+func (m *fakeMarketplace) Name() string {
+	return m.name
+}
+
 func (m *fakeMarketplace) Search(context.Context, string) ([]product.Product, error) {
 	m.calls++
 	return m.products, m.err
 }
 
 type fakeCache struct {
-	products []product.Product
-	getErr   error
-	setErr   error
-	setCalls int
+	products  []product.Product
+	sources   []SourceStatus
+	fetchedAt time.Time
+	getErr    error
+	setErr    error
+	setCalls  int
+	ttl       time.Duration
 }
 
-func (c *fakeCache) Get(context.Context, string) ([]product.Product, error) {
-	return c.products, c.getErr
+func (c *fakeCache) Get(context.Context, string) (Entry, error) {
+	return Entry{Products: c.products, Sources: c.sources, FetchedAt: c.fetchedAt}, c.getErr
 }
 
-func (c *fakeCache) Set(_ context.Context, _ string, products []product.Product) error {
-	c.products = products
+func (c *fakeCache) Set(_ context.Context, _ string, entry Entry, ttl time.Duration) error {
+	c.products = entry.Products
+	c.sources = entry.Sources
+	c.fetchedAt = entry.FetchedAt
+	c.ttl = ttl
 	c.setCalls++
 	return c.setErr
 }
 
 func TestSearchUsesCache(t *testing.T) {
 	cached := []product.Product{{ProductID: "cached", DiscountPriceKopecks: 500}}
-	cache := &fakeCache{products: cached}
+	cache := &fakeCache{products: cached, fetchedAt: time.Now()}
 	marketplace := &fakeMarketplace{}
 	service := New(slog.Default(), cache, marketplace)
 
-	products, err := service.Search(context.Background(), " Phone ")
+	result, err := service.Search(context.Background(), " Phone ", Options{})
 	if err != nil {
 		t.Fatalf("Search() error = %v", err)
 	}
+	products := result.Products
 	if len(products) != 1 || products[0].ProductID != "cached" {
 		t.Fatalf("Search() products = %#v", products)
 	}
@@ -59,19 +74,44 @@ func TestSearchSortsAndCachesPartialResult(t *testing.T) {
 	cache := &fakeCache{getErr: errors.New("cache miss")}
 	first := &fakeMarketplace{products: []product.Product{{ProductID: "expensive", DiscountPriceKopecks: 2_000}}}
 	second := &fakeMarketplace{products: []product.Product{{ProductID: "cheap", DiscountPriceKopecks: 1_000}}}
-	failed := &fakeMarketplace{err: errors.New("unavailable")}
+	failed := &fakeMarketplace{name: "failed", err: errors.New("unavailable")}
 	service := New(slog.Default(), cache, first, second, failed)
 
-	products, err := service.Search(context.Background(), "phone")
+	result, err := service.Search(context.Background(), "phone", Options{})
 	if err != nil {
 		t.Fatalf("Search() error = %v", err)
 	}
+	products := result.Products
 	if products[0].ProductID != "cheap" || products[1].ProductID != "expensive" {
 		t.Fatalf("Search() did not sort products: %#v", products)
 	}
 	if cache.setCalls != 1 {
 		t.Fatalf("cache Set calls = %d, want 1", cache.setCalls)
 	}
+	if !result.Partial || result.Cached || result.CachedAt != nil {
+		t.Fatalf("Search() flags = partial %v, cached %v, cached_at %v", result.Partial, result.Cached, result.CachedAt)
+	}
+	if len(result.Sources) != 3 {
+		t.Fatalf("Search() sources = %#v", result.Sources)
+	}
+	var failedStatus SourceStatus
+	for _, source := range result.Sources {
+		if source.Marketplace == "failed" {
+			failedStatus = source
+		}
+	}
+	if failedStatus.Status != StatusError || failedStatus.Error != CodeUnavailable {
+		t.Fatalf("failed source status = %#v", failedStatus)
+	}
+
+	cache.getErr = nil
+	cachedResult, err := service.Search(context.Background(), "phone", Options{})
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	if !cachedResult.Cached || cachedResult.CachedAt == nil || !cachedResult.CachedAt.Equal(cache.fetchedAt) || !cachedResult.Partial {
+		t.Fatalf("cached Search() = %#v", cachedResult)
+	}
 }
 
 func TestSearchReturnsErrorWhenAllMarketplacesFail(t *testing.T) {
@@ -80,7 +120,227 @@ func TestSearchReturnsErrorWhenAllMarketplacesFail(t *testing.T) {
 		&fakeMarketplace{err: errors.New("wb unavailable")},
 	)
 
-	if _, err := service.Search(context.Background(), "phone"); err == nil {
+	if _, err := service.Search(context.Background(), "phone", Options{}); err == nil {
 		t.Fatal("Search() error = nil, want error")
 	}
 }
+
+func TestSearchFiltersCachedResult(t *testing.T) {
+	cache := &fakeCache{fetchedAt: time.Now(), products: []product.Product{
+		{ProductID: "cheap", Marketplace: "wb", DiscountPriceKopecks: 500, ProductStars: "4.9", ProductReviews: "100"},
+		{ProductID: "unrated", Marketplace: "wb", DiscountPriceKopecks: 1_000},
+		{ProductID: "ozon", Marketplace: "ozon", DiscountPriceKopecks: 1_500, ProductStars: "4,7", ProductReviews: "20 отзывов"},
+		{ProductID: "expensive", Marketplace: "wb", DiscountPriceKopecks: 9_000, ProductStars: "5", ProductReviews: "3"},
+	}}
+	marketplace := &fakeMarketplace{}
+	service := New(slog.Default(), cache, marketplace)
+
+	result, err := service.Search(context.Background(), "phone", Options{Filter: Filter{
+		MinPriceKopecks: 500,
+		MaxPriceKopecks: 5_000,
+		MinRating:       4.5,
+		MinReviews:      10,
+		Marketplaces:    []string{"wb"},
+	}})
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	products := result.Products
+	if len(products) != 1 || products[0].ProductID != "cheap" {
+		t.Fatalf("Search() products = %#v", products)
+	}
+	if len(cache.products) != 4 {
+		t.Fatalf("filter modified cached products: %#v", cache.products)
+	}
+	if marketplace.calls != 0 {
+		t.Fatalf("marketplace calls = %d, want 0", marketplace.calls)
+	}
+}
+
+func TestSearchSortsCachedResult(t *testing.T) {
+	cache := &fakeCache{fetchedAt: time.Now(), products: []product.Product{
+		{Key: "wb:1", ProductName: "Phone 150", DiscountPriceKopecks: 1_000, BasePriceKopecks: 1_100, ProductStars: "4.1", ProductReviews: "7"},
+		{Key: "ozon:1", ProductName: "Phone 15", DiscountPriceKopecks: 3_000, BasePriceKopecks: 6_000, ProductStars: "4,9", ProductReviews: "2 отзыва"},
+		{Key: "ozon:2", ProductName: "Case", DiscountPriceKopecks: 1_000, ProductStars: "4.1", ProductReviews: "50"},
+	}}
+	service := New(slog.Default(), cache, &fakeMarketplace{})
+
+	tests := []struct {
+		order SortOrder
+		want  []string
+	}{
+		{order: "", want: []string{"ozon:2", "wb:1", "ozon:1"}},
+		{order: SortPriceDesc, want: []string{"ozon:1", "ozon:2", "wb:1"}},
+		{order: SortRating, want: []string{"ozon:1", "ozon:2", "wb:1"}},
+		{order: SortReviews, want: []string{"ozon:2", "wb:1", "ozon:1"}},
+		{order: SortDiscountPercent, want: []string{"ozon:1", "wb:1", "ozon:2"}},
+		{order: SortRelevance, want: []string{"ozon:1", "wb:1", "ozon:2"}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.order), func(t *testing.T) {
+			result, err := service.Search(context.Background(), "phone 15", Options{Sort: tt.order})
+			if err != nil {
+				t.Fatalf("Search() error = %v", err)
+			}
+			products := result.Products
+			var got []string
+			for _, p := range products {
+				got = append(got, p.Key)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Fatalf("Search() order = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+type blockingMarketplace struct {
+	name    string
+	release chan struct{}
+}
+
+func (m *blockingMarketplace) Name() string {
+	return m.name
+}
+
+func (m *blockingMarketplace) Search(ctx context.Context, _ string) ([]product.Product, error) {
+	select {
+	case <-m.release:
+		return []product.Product{{Key: m.name + ":1", Marketplace: m.name, DiscountPriceKopecks: 100}}, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+type recordingStream struct {
+	events  []string
+	onBatch func()
+}
+
+func (r *recordingStream) Batch(batch Batch) error {
+	r.events = append(r.events, fmt.Sprintf("batch %s %d %t", batch.Marketplace, len(batch.Products), batch.Cached))
+	if r.onBatch != nil {
+		r.onBatch()
+	}
+	return nil
+}
+
+func (r *recordingStream) Status(status SourceStatus) error {
+	r.events = append(r.events, fmt.Sprintf("status %s %s %d", status.Marketplace, status.Status, status.Count))
+	return nil
+}
+
+func (r *recordingStream) Summary(summary Summary) error {
+	r.events = append(r.events, fmt.Sprintf("summary %d %t %d", summary.Total, summary.Cached, len(summary.Sources)))
+	return nil
+}
+
+func TestStreamSendsBatchesAsMarketplacesAnswer(t *testing.T) {
+	cache := &fakeCache{getErr: errors.New("cache miss")}
+	fast := &fakeMarketplace{name: "wb", products: []product.Product{{Key: "wb:1", DiscountPriceKopecks: 500}}}
+	slow := &blockingMarketplace{name: "ozon", release: make(chan struct{})}
+	failed := &fakeMarketplace{name: "avito", err: errors.New("unavailable")}
+	service := New(slog.Default(), cache, fast, slow, failed)
+
+	stream := &recordingStream{}
+	var released bool
+	stream.onBatch = func() {
+		if !released {
+			released = true
+			close(slow.release)
+		}
+	}
+	if err := service.Stream(context.Background(), "phone", Options{}, stream); err != nil {
+		t.Fatalf("Stream() error = %v", err)
+	}
+
+	got := strings.Join(stream.events, "\n")
+	for _, want := range []string{"batch wb 1 false", "status wb ok 1", "batch ozon 1 false", "status ozon ok 1", "status avito error 0"} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("events = %s, missing %q", got, want)
+		}
+	}
+	if last := stream.events[len(stream.events)-1]; last != "summary 2 false 3" {
+		t.Fatalf("last event = %q", last)
+	}
+	if cache.setCalls != 1 || len(cache.products) != 2 {
+		t.Fatalf("cache Set calls = %d, products = %d", cache.setCalls, len(cache.products))
+	}
+
+	cached := &recordingStream{}
+	cache.getErr = nil
+	if err := service.Stream(context.Background(), "phone", Options{}, cached); err != nil {
+		t.Fatalf("Stream() error = %v", err)
+	}
+	if strings.Join(cached.events, ";") != "batch  2 true;summary 2 true 3" {
+		t.Fatalf("cached events = %v", cached.events)
+	}
+}
+
+type fakeRecorder struct {
+	products []product.Product
+	calls    int
+}
+
+func (r *fakeRecorder) Record(_ context.Context, products []product.Product, _ time.Time) error {
+	r.products = products
+	r.calls++
+	return nil
+}
+
+func TestSearchRecordsFetchedProducts(t *testing.T) {
+	cache := &fakeCache{getErr: errors.New("cache miss")}
+	service := New(slog.Default(), cache, &fakeMarketplace{name: "wb", products: []product.Product{{ProductID: "1", DiscountPriceKopecks: 100}}})
+	recorder := &fakeRecorder{}
+	service.SetRecorder(recorder)
+
+	if _, err := service.Search(context.Background(), "phone", Options{}); err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	if recorder.calls != 1 || len(recorder.products) != 1 {
+		t.Fatalf("Record() calls = %d, products = %#v", recorder.calls, recorder.products)
+	}
+
+	cache.getErr = nil
+	if _, err := service.Search(context.Background(), "phone", Options{}); err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	if recorder.calls != 1 {
+		t.Fatalf("cached result recorded again: calls = %d", recorder.calls)
+	}
+}
+
+type fakeChecker struct {
+	before time.Time
+}
+
+func (c *fakeChecker) CheckPrices(_ context.Context, products []product.Product, before time.Time) (map[string]product.PriceCheck, error) {
+	c.before = before
+	checks := make(map[string]product.PriceCheck)
+	for _, p := range products {
+		checks[product.Key(p.Marketplace, p.ProductID)] = product.PriceCheck{Verdict: product.VerdictFake}
+	}
+	return checks, nil
+}
+
+func TestSearchChecksPricesWithoutChangingCache(t *testing.T) {
+	fetchedAt := time.Now().Add(-time.Minute)
+	cache := &fakeCache{fetchedAt: fetchedAt, products: []product.Product{{Marketplace: "wb", ProductID: "1", DiscountPriceKopecks: 100}}}
+	service := New(slog.Default(), cache, &fakeMarketplace{name: "wb"})
+	checker := &fakeChecker{}
+	service.SetPriceChecker(checker)
+
+	result, err := service.Search(context.Background(), "phone", Options{})
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	if check := result.Products[0].PriceCheck; check == nil || check.Verdict != product.VerdictFake {
+		t.Fatalf("Search() price check = %#v", check)
+	}
+	if !checker.before.Equal(fetchedAt) {
+		t.Fatalf("CheckPrices() before = %v, want %v", checker.before, fetchedAt)
+	}
+	if cache.products[0].PriceCheck != nil {
+		t.Fatal("price check stored in the cached products")
+	}
+}
@@ -0,0 +1,134 @@
+package search
+
+import (
+	"cmp"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"agregator/internal/product"
+)
+
+type SortOrder string
+
+const (
+	SortPriceAsc        SortOrder = "price_asc"
+	SortPriceDesc       SortOrder = "price_desc"
+	SortRating          SortOrder = "rating"
+	SortReviews         SortOrder = "reviews"
+	SortDiscountPercent SortOrder = "discount_percent"
+	SortRelevance       SortOrder = "relevance"
+)
+
+func ParseSortOrder(value string) (SortOrder, error) {
+	switch order := SortOrder(value); order {
+	case "":
+		return SortPriceAsc, nil
+	case SortPriceAsc, SortPriceDesc, SortRating, SortReviews, SortDiscountPercent, SortRelevance:
+		return order, nil
+	default:
+		return "", fmt.Errorf("unknown sort order %q", value)
+	}
+}
+
+// Sort orders products in place. Equal products are ordered by price and then
+// by product key, so the result does not depend on which marketplace answered
+// first.
+func Sort(products []product.Product, order SortOrder, query string) {
+	var primary func(a, b product.Product) int
+	switch order {
+	case SortPriceDesc:
+		primary = func(a, b product.Product) int { return cmp.Compare(b.DiscountPriceKopecks, a.DiscountPriceKopecks) }
+	case SortRating:
+		primary = func(a, b product.Product) int {
+			ar, _ := a.Rating()
+			br, _ := b.Rating()
+			return cmp.Compare(br, ar)
+		}
+	case SortReviews:
+		primary = func(a, b product.Product) int {
+			ar, _ := a.ReviewCount()
+			br, _ := b.ReviewCount()
+			return cmp.Compare(br, ar)
+		}
+	case SortDiscountPercent:
+		primary = func(a, b product.Product) int { return cmp.Compare(b.DiscountPercent(), a.DiscountPercent()) }
+	case SortRelevance:
+		tokens := queryTokens(query)
+		scores := make(map[string]float64, len(products))
+		for _, p := range products {
+			scores[p.Key] = relevance(p.ProductName, tokens)
+		}
+		primary = func(a, b product.Product) int { return cmp.Compare(scores[b.Key], scores[a.Key]) }
+	default:
+		primary = func(product.Product, product.Product) int { return 0 }
+	}
+
+	sort.SliceStable(products, func(i, j int) bool {
+		a, b := products[i], products[j]
+		if c := primary(a, b); c != 0 {
+			return c < 0
+		}
+		if c := cmp.Compare(a.DiscountPriceKopecks, b.DiscountPriceKopecks); c != 0 {
+			return c < 0
+		}
+		return a.Key < b.Key
+	})
+}
+
+// relevance returns the share of query tokens found in name. Numeric tokens
+// must match a whole number, so "15" does not match "150".
+func relevance(name string, tokens []string) float64 {
+	if len(tokens) == 0 {
+		return 0
+	}
+	normalized := " " + strings.Join(queryTokens(name), " ") + " "
+	var matched int
+	for _, token := range tokens {
+		if isNumber(token) {
+			if containsNumber(normalized, token) {
+				matched++
+			}
+			continue
+		}
+		if strings.Contains(normalized, token) {
+			matched++
+		}
+	}
+	return float64(matched) / float64(len(tokens))
+}
+
+func queryTokens(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+func containsNumber(s, number string) bool {
+	for offset := 0; offset < len(s); {
+		i := strings.Index(s[offset:], number)
+		if i < 0 {
+			return false
+		}
+		start, end := offset+i, offset+i+len(number)
+		if (start == 0 || !isDigit(s[start-1])) && (end == len(s) || !isDigit(s[end])) {
+			return true
+		}
+		offset = start + 1
+	}
+	return false
+}
+
+func isDigit(b byte) bool {
+	return b >= '0' && b <= '9'
+}
+
+func isNumber(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if !isDigit(s[i]) {
+			return false
+		}
+	}
+	return s != ""
+}
@@ -0,0 +1,104 @@
+package search
+
+import (
+	"context"
+	"time"
+
+	"agregator/internal/product"
+)
+
+const (
+	StatusOK      = "ok"
+	StatusError   = "error"
+	StatusTimeout = "timeout"
+)
+
+// Batch holds the products of one marketplace, or the whole cached result when
+// Cached is set.
+type Batch struct {
+	Marketplace string            `json:"marketplace,omitempty"`
+	Products    []product.Product `json:"products"`
+	Cached      bool              `json:"cached"`
+}
+
+// SourceStatus reports how one marketplace answered. Error holds a stable code
+// rather than the error text, which may contain upstream details.
+type SourceStatus struct {
+	Marketplace string `json:"marketplace"`
+	Status      string `json:"status"`
+	Count       int    `json:"count"`
+	LatencyMS   int64  `json:"latency_ms"`
+	Error       string `json:"error,omitempty"`
+}
+
+type Summary struct {
+	Total      int            `json:"total"`
+	Partial    bool           `json:"partial"`
+	Cached     bool           `json:"cached"`
+	Stale      bool           `json:"stale"`
+	AgeSeconds int64          `json:"age_seconds"`
+	Sources    []SourceStatus `json:"sources"`
+}
+
+// StreamHandler receives the events of Stream. An error returned by a method,
+// e.g. because the client has gone away, stops further events.
+type StreamHandler interface {
+	Batch(Batch) error
+	Status(SourceStatus) error
+	Summary(Summary) error
+}
+
+// Stream sends each marketplace's products as soon as that marketplace answers
+// instead of waiting for the slowest one. A cached result is sent as a single
+// batch. The summary is always the last event; the returned error describes the
+// search itself and is meant for logging.
+func (s *Service) Stream(ctx context.Context, query string, options Options, handler StreamHandler) error {
+	query = NormalizeQuery(query)
+	if entry, state := s.cached(ctx, query); state != missing {
+		if state == stale {
+			s.refresh(ctx, query, entry)
+		}
+		batch := s.checkPrices(ctx, options.apply(entry.Products, query), entry.FetchedAt)
+		if err := handler.Batch(Batch{Products: batch, Cached: true}); err != nil {
+			return err
+		}
+		err := handler.Summary(Summary{
+			Total:      len(batch),
+			Partial:    entry.partial(),
+			Cached:     true,
+			Stale:      state == stale,
+			AgeSeconds: int64(entry.age().Seconds()),
+			Sources:    entry.Sources,
+		})
+		if err == nil && len(entry.Products) == 0 {
+			err = ErrProductsNotFound
+		}
+		return err
+	}
+
+	summary := Summary{Sources: []SourceStatus{}}
+	started := time.Now()
+	var sendErr error
+	_, err := s.fetchShared(ctx, query, func(result sourceResult) {
+		status := result.source
+		summary.Sources = append(summary.Sources, status)
+		summary.Partial = summary.Partial || status.Status != StatusOK
+		if sendErr != nil {
+			return
+		}
+		if batch := s.checkPrices(ctx, options.apply(result.products, query), started); len(batch) > 0 {
+			summary.Total += len(batch)
+			if sendErr = handler.Batch(Batch{Marketplace: status.Marketplace, Products: batch}); sendErr != nil {
+				return
+			}
+		}
+		sendErr = handler.Status(status)
+	})
+	if sendErr != nil {
+		return sendErr
+	}
+	if sendErr = handler.Summary(summary); sendErr != nil {
+		return sendErr
+	}
+	return err
+}
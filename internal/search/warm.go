@@ -0,0 +1,102 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+)
+
+// WarmProgress is the state of a WarmJob. Queries without products count as
+// done when every marketplace answered, since the empty result is cached as
+// well; if some of them failed, the query has failed.
+type WarmProgress struct {
+	Total      int         `json:"total"`
+	Done       int         `json:"done"`
+	Failed     int         `json:"failed"`
+	Running    bool        `json:"running"`
+	Errors     []WarmError `json:"errors,omitempty"`
+	StartedAt  time.Time   `json:"started_at"`
+	FinishedAt *time.Time  `json:"finished_at,omitempty"`
+}
+
+type WarmError struct {
+	Query string `json:"query"`
+	Code  string `json:"code"`
+}
+
+// WarmJob fetches a list of queries in the background, replacing their cached
+// results.
+type WarmJob struct {
+	mu       sync.Mutex
+	progress WarmProgress
+	done     chan struct{}
+}
+
+// Warm starts a job that fetches queries from the marketplaces regardless of
+// the cache, at most concurrency at a time. Fetches already in progress for a
+// query are shared.
+func (s *Service) Warm(ctx context.Context, queries []string, concurrency int) *WarmJob {
+	started := time.Now()
+	job := &WarmJob{
+		progress: WarmProgress{Total: len(queries), Running: true, StartedAt: started},
+		done:     make(chan struct{}),
+	}
+	go func() {
+		defer close(job.done)
+		var wg sync.WaitGroup
+		sem := make(chan struct{}, max(concurrency, 1))
+	loop:
+		for _, query := range queries {
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				break loop
+			}
+			wg.Add(1)
+			go func(query string) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				_, err := s.fetchSince(ctx, NormalizeQuery(query), started, nil)
+				job.record(query, err)
+			}(query)
+		}
+		wg.Wait()
+		job.finish()
+		s.logger.Info("cache warm finished", "queries", len(queries), "failed", job.Progress().Failed)
+	}()
+	return job
+}
+
+func (j *WarmJob) record(query string, err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if err != nil && (!errors.Is(err, ErrProductsNotFound) || errors.Is(err, ErrSourcesFailed)) {
+		j.progress.Failed++
+		j.progress.Errors = append(j.progress.Errors, WarmError{Query: query, Code: errorCode(err)})
+		return
+	}
+	j.progress.Done++
+}
+
+func (j *WarmJob) finish() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	now := time.Now()
+	j.progress.Running = false
+	j.progress.FinishedAt = &now
+}
+
+func (j *WarmJob) Progress() WarmProgress {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	progress := j.progress
+	progress.Errors = slices.Clone(j.progress.Errors)
+	return progress
+}
+
+// Wait blocks until the job has finished.
+func (j *WarmJob) Wait() {
+	<-j.done
+}
@@ -0,0 +1,66 @@
+package search
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	"agregator/internal/product"
+)
+
+func TestWarmReplacesCachedResults(t *testing.T) {
+	cache := &fakeCache{products: []product.Product{{Key: "wb:old"}}, fetchedAt: time.Now()}
+	marketplace := &fakeMarketplace{name: "wb", products: []product.Product{{Key: "wb:new"}}}
+	service := New(slog.Default(), cache, marketplace)
+
+	job := service.Warm(context.Background(), []string{"Phone"}, 2)
+	job.Wait()
+
+	progress := job.Progress()
+	if progress.Running || progress.Total != 1 || progress.Done != 1 || progress.Failed != 0 {
+		t.Fatalf("Progress() = %#v", progress)
+	}
+	if marketplace.calls != 1 || cache.products[0].Key != "wb:new" {
+		t.Fatalf("calls = %d, cached = %#v", marketplace.calls, cache.products)
+	}
+}
+
+func TestWarmReportsFailedQueries(t *testing.T) {
+	marketplace := &fakeMarketplace{name: "wb", err: ErrRateLimited}
+	service := New(slog.Default(), nil, marketplace)
+
+	job := service.Warm(context.Background(), []string{"phone", "tv"}, 1)
+	job.Wait()
+
+	progress := job.Progress()
+	if progress.Failed != 2 || len(progress.Errors) != 2 || progress.Errors[0].Code != CodeRateLimited {
+		t.Fatalf("Progress() = %#v", progress)
+	}
+}
+
+func TestWarmFailsEmptyResultsOfPartialFailures(t *testing.T) {
+	cache := &fakeCache{}
+	service := New(slog.Default(), cache,
+		&fakeMarketplace{name: "wb"},
+		&fakeMarketplace{name: "ozon", err: ErrRateLimited},
+	)
+
+	job := service.Warm(context.Background(), []string{"phone"}, 1)
+	job.Wait()
+
+	progress := job.Progress()
+	if progress.Done != 0 || progress.Failed != 1 || len(progress.Errors) != 1 || progress.Errors[0].Code != CodeRateLimited {
+		t.Fatalf("Progress() = %#v", progress)
+	}
+	if cache.setCalls != 0 {
+		t.Fatalf("setCalls = %d, want the empty result not cached", cache.setCalls)
+	}
+
+	service = New(slog.Default(), cache, &fakeMarketplace{name: "wb"})
+	job = service.Warm(context.Background(), []string{"phone"}, 1)
+	job.Wait()
+	if progress := job.Progress(); progress.Done != 1 || progress.Failed != 0 || cache.setCalls != 1 {
+		t.Fatalf("Progress() = %#v, setCalls = %d, want the empty result cached", progress, cache.setCalls)
+	}
+}
@@ -0,0 +1,148 @@
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultAPIURL is the base URL of the Telegram Bot API.
+const DefaultAPIURL = "https://api.telegram.org"
+
+type Update struct {
+	UpdateID      int64          `json:"update_id"`
+	Message       *Message       `json:"message,omitempty"`
+	CallbackQuery *CallbackQuery `json:"callback_query,omitempty"`
+}
+
+type Message struct {
+	MessageID int64  `json:"message_id"`
+	Chat      Chat   `json:"chat"`
+	Text      string `json:"text"`
+}
+
+type Chat struct {
+	ID int64 `json:"id"`
+}
+
+type CallbackQuery struct {
+	ID      string   `json:"id"`
+	Message *Message `json:"message,omitempty"`
+	Data    string   `json:"data"`
+}
+
+type InlineKeyboardMarkup struct {
+	InlineKeyboard [][]InlineKeyboardButton `json:"inline_keyboard"`
+}
+
+type InlineKeyboardButton struct {
+	Text         string `json:"text"`
+	CallbackData string `json:"callback_data,omitempty"`
+}
+
+// Client calls the Bot API methods the bot needs.
+type Client struct {
+	baseURL string
+	token   string
+	client  *http.Client
+}
+
+// NewClient creates a client for the API at baseURL, DefaultAPIURL in
+// production and a fake server in tests.
+func NewClient(baseURL, token string) *Client {
+	return &Client{baseURL: strings.TrimRight(baseURL, "/"), token: token, client: &http.Client{}}
+}
+
+type apiResponse struct {
+	OK          bool            `json:"ok"`
+	Result      json.RawMessage `json:"result"`
+	Description string          `json:"description"`
+}
+
+func (c *Client) call(ctx context.Context, method string, params, result any) error {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return fmt.Errorf("telegram %s: %w", method, err)
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/bot"+c.token+"/"+method, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("telegram %s: %w", method, err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	response, err := c.client.Do(request)
+	if err != nil {
+		// The error contains the URL and with it the token.
+		return fmt.Errorf("telegram %s: %s", method, strings.ReplaceAll(err.Error(), c.token, "<token>"))
+	}
+	defer response.Body.Close()
+
+	var decoded apiResponse
+	if err := json.NewDecoder(response.Body).Decode(&decoded); err != nil {
+		return fmt.Errorf("telegram %s: status %d: %w", method, response.StatusCode, err)
+	}
+	if !decoded.OK {
+		return fmt.Errorf("telegram %s: %s", method, decoded.Description)
+	}
+	if result != nil {
+		if err := json.Unmarshal(decoded.Result, result); err != nil {
+			return fmt.Errorf("telegram %s: %w", method, err)
+		}
+	}
+	return nil
+}
+
+// GetUpdates waits up to timeout for updates after offset.
+func (c *Client) GetUpdates(ctx context.Context, offset int64, timeout time.Duration) ([]Update, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout+10*time.Second)
+	defer cancel()
+	var updates []Update
+	err := c.call(ctx, "getUpdates", map[string]any{
+		"offset":          offset,
+		"timeout":         int(timeout.Seconds()),
+		"allowed_updates": []string{"message", "callback_query"},
+	}, &updates)
+	return updates, err
+}
+
+type messageParams struct {
+	ChatID             int64                 `json:"chat_id"`
+	MessageID          int64                 `json:"message_id,omitempty"`
+	Text               string                `json:"text"`
+	ParseMode          string                `json:"parse_mode"`
+	LinkPreviewOptions map[string]bool       `json:"link_preview_options"`
+	ReplyMarkup        *InlineKeyboardMarkup `json:"reply_markup,omitempty"`
+}
+
+func newMessageParams(chatID int64, text string, markup *InlineKeyboardMarkup) messageParams {
+	return messageParams{
+		ChatID:             chatID,
+		Text:               text,
+		ParseMode:          "HTML",
+		LinkPreviewOptions: map[string]bool{"is_disabled": true},
+		ReplyMarkup:        markup,
+	}
+}
+
+// SendMessage sends HTML text with an optional inline keyboard.
+func (c *Client) SendMessage(ctx context.Context, chatID int64, text string, markup *InlineKeyboardMarkup) (Message, error) {
+	var message Message
+	err := c.call(ctx, "sendMessage", newMessageParams(chatID, text, markup), &message)
+	return message, err
+}
+
+// EditMessageText replaces the text and keyboard of a message sent by the bot.
+func (c *Client) EditMessageText(ctx context.Context, chatID, messageID int64, text string, markup *InlineKeyboardMarkup) error {
+	params := newMessageParams(chatID, text, markup)
+	params.MessageID = messageID
+	return c.call(ctx, "editMessageText", params, nil)
+}
+
+// AnswerCallbackQuery stops the loading indicator of a pressed button and
+// optionally shows text.
+func (c *Client) AnswerCallbackQuery(ctx context.Context, id, text string) error {
+	return c.call(ctx, "answerCallbackQuery", map[string]string{"callback_query_id": id, "text": text}, nil)
+}
@@ -0,0 +1,300 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"agregator/internal/search"
+	"agregator/internal/watch"
+)
+
+const (
+	pollTimeout   = 30 * time.Second
+	retryDelay    = 5 * time.Second
+	keptSessions  = 1000
+	expiredAnswer = "Запрос устарел, отправьте его ещё раз"
+)
+
+type Options struct {
+	// PageSize is the number of offers per message, 5 by default.
+	PageSize int
+	// Labels maps marketplace names to the names shown to users.
+	Labels map[string]string
+	// SearchTimeout limits one search, 60s by default.
+	SearchTimeout time.Duration
+}
+
+// Bot answers text messages with the cheapest offers and manages watchlists
+// with the /watch, /watches and /unwatch commands. Watches are owned by
+// "telegram:<chat ID>".
+type Bot struct {
+	api     *Client
+	search  *search.Service
+	watches *watch.Store
+	options Options
+	logger  *slog.Logger
+
+	mu       sync.Mutex
+	sessions map[session]string
+	order    []session
+}
+
+// session identifies a result message, whose buttons page through its query.
+type session struct {
+	chatID    int64
+	messageID int64
+}
+
+// NewBot creates a bot. watches may be nil, then the watch commands answer
+// that watchlists are disabled.
+func NewBot(logger *slog.Logger, api *Client, searchService *search.Service, watches *watch.Store, options Options) *Bot {
+	if options.PageSize <= 0 {
+		options.PageSize = 5
+	}
+	if options.SearchTimeout <= 0 {
+		options.SearchTimeout = 60 * time.Second
+	}
+	return &Bot{
+		logger:   logger,
+		api:      api,
+		search:   searchService,
+		watches:  watches,
+		options:  options,
+		sessions: make(map[session]string),
+	}
+}
+
+// Run polls for updates until ctx is done. Updates are handled concurrently
+// because a search may take a while.
+func (b *Bot) Run(ctx context.Context) error {
+	var offset int64
+	for {
+		updates, err := b.api.GetUpdates(ctx, offset, pollTimeout)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			b.logger.Warn("get telegram updates", "error", err)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(retryDelay):
+			}
+			continue
+		}
+		for _, update := range updates {
+			offset = max(offset, update.UpdateID+1)
+			go b.handle(ctx, update)
+		}
+	}
+}
+
+func (b *Bot) handle(ctx context.Context, update Update) {
+	var err error
+	switch {
+	case update.Message != nil:
+		err = b.handleMessage(ctx, *update.Message)
+	case update.CallbackQuery != nil:
+		err = b.handleCallback(ctx, *update.CallbackQuery)
+	}
+	if err != nil {
+		b.logger.Error("handle telegram update", "update", update.UpdateID, "error", err)
+	}
+}
+
+func (b *Bot) handleMessage(ctx context.Context, message Message) error {
+	text := strings.TrimSpace(message.Text)
+	command, args, _ := strings.Cut(text, " ")
+	command, _, _ = strings.Cut(command, "@")
+	args = strings.TrimSpace(args)
+
+	var reply string
+	switch {
+	case text == "":
+		return nil
+	case command == "/start" || command == "/help":
+		reply = helpText
+	case command == "/watch":
+		reply = b.watch(ctx, message.Chat.ID, args)
+	case command == "/watches":
+		reply = b.listWatches(ctx, message.Chat.ID)
+	case command == "/unwatch":
+		reply = b.unwatch(ctx, message.Chat.ID, args)
+	case strings.HasPrefix(command, "/"):
+		reply = "Неизвестная команда.\n\n" + helpText
+	default:
+		query := search.NormalizeQuery(text)
+		text, markup := b.results(ctx, query, 0, search.SortPriceAsc)
+		sent, err := b.api.SendMessage(ctx, message.Chat.ID, text, markup)
+		if err != nil {
+			return err
+		}
+		if markup != nil {
+			b.remember(session{chatID: sent.Chat.ID, messageID: sent.MessageID}, query)
+		}
+		return nil
+	}
+	_, err := b.api.SendMessage(ctx, message.Chat.ID, reply, nil)
+	return err
+}
+
+// handleCallback shows another page or sort order of a result message. The
+// callback data is "p:<page>:<sort order>".
+func (b *Bot) handleCallback(ctx context.Context, callback CallbackQuery) error {
+	page, order, ok := parseCallback(callback.Data)
+	if !ok || callback.Message == nil {
+		return b.api.AnswerCallbackQuery(ctx, callback.ID, "")
+	}
+	key := session{chatID: callback.Message.Chat.ID, messageID: callback.Message.MessageID}
+	b.mu.Lock()
+	query, found := b.sessions[key]
+	b.mu.Unlock()
+	if !found {
+		return b.api.AnswerCallbackQuery(ctx, callback.ID, expiredAnswer)
+	}
+
+	text, markup := b.results(ctx, query, page, order)
+	err := b.api.EditMessageText(ctx, key.chatID, key.messageID, text, markup)
+	if answerErr := b.api.AnswerCallbackQuery(ctx, callback.ID, ""); err == nil {
+		err = answerErr
+	}
+	return err
+}
+
+func parseCallback(data string) (int, search.SortOrder, bool) {
+	parts := strings.Split(data, ":")
+	if len(parts) != 3 || parts[0] != "p" {
+		return 0, "", false
+	}
+	page, err := strconv.Atoi(parts[1])
+	if err != nil || page < 0 {
+		return 0, "", false
+	}
+	order, err := search.ParseSortOrder(parts[2])
+	if err != nil {
+		return 0, "", false
+	}
+	return page, order, true
+}
+
+// results renders a page of the offers for query. The keyboard is nil when
+// the search failed.
+func (b *Bot) results(ctx context.Context, query string, page int, order search.SortOrder) (string, *InlineKeyboardMarkup) {
+	ctx, cancel := context.WithTimeout(ctx, b.options.SearchTimeout)
+	defer cancel()
+	result, err := b.search.Search(ctx, query, search.Options{Sort: order})
+	if err != nil {
+		if !errors.Is(err, search.ErrProductsNotFound) {
+			b.logger.Warn("telegram search failed", "query", query, "error", err)
+		}
+		return searchErrorText(err), nil
+	}
+	pages := (len(result.Products) + b.options.PageSize - 1) / b.options.PageSize
+	page = min(page, pages-1)
+	start := page * b.options.PageSize
+	products := result.Products[start:min(start+b.options.PageSize, len(result.Products))]
+	return formatResults(query, products, start, len(result.Products), page, pages, result.Partial, b.options.Labels),
+		keyboard(page, pages, order)
+}
+
+func (b *Bot) remember(key session, query string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.sessions[key] = query
+	b.order = append(b.order, key)
+	if len(b.order) > keptSessions {
+		delete(b.sessions, b.order[0])
+		b.order = b.order[1:]
+	}
+}
+
+// watch handles "/watch <price> <query>" and "/watch -<percent>% <query>".
+func (b *Bot) watch(ctx context.Context, chatID int64, args string) string {
+	if b.watches == nil {
+		return "Отслеживание цен отключено."
+	}
+	threshold, query, _ := strings.Cut(args, " ")
+	sub := watch.Subscription{Owner: watch.OwnerTelegram + strconv.FormatInt(chatID, 10), Query: query}
+	if percent, ok := strings.CutSuffix(threshold, "%"); ok {
+		value, err := strconv.ParseFloat(strings.TrimPrefix(percent, "-"), 64)
+		if err != nil {
+			return watchUsage
+		}
+		sub.DropPercent = value
+	} else {
+		price, err := strconv.ParseFloat(strings.Replace(threshold, ",", ".", 1), 64)
+		if err != nil || price <= 0 {
+			return watchUsage
+		}
+		sub.TargetPriceKopecks = int64(price*100 + 0.5)
+	}
+	sub, err := b.watches.Add(ctx, sub)
+	if err != nil {
+		return watchUsage
+	}
+	return fmt.Sprintf("Подписка %d: %s", sub.ID, describeWatch(sub))
+}
+
+func (b *Bot) listWatches(ctx context.Context, chatID int64) string {
+	if b.watches == nil {
+		return "Отслеживание цен отключено."
+	}
+	subs, err := b.watches.List(ctx, watch.OwnerTelegram+strconv.FormatInt(chatID, 10))
+	if err != nil {
+		b.logger.Error("list telegram watches", "chat", chatID, "error", err)
+		return "Не удалось получить подписки, попробуйте позже."
+	}
+	if len(subs) == 0 {
+		return "Подписок нет. " + watchUsage
+	}
+	lines := []string{"<b>Подписки</b>"}
+	for _, sub := range subs {
+		lines = append(lines, fmt.Sprintf("%d. %s", sub.ID, describeWatch(sub)))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (b *Bot) unwatch(ctx context.Context, chatID int64, args string) string {
+	if b.watches == nil {
+		return "Отслеживание цен отключено."
+	}
+	id, err := strconv.ParseInt(args, 10, 64)
+	if err != nil {
+		return "Укажите номер подписки: /unwatch 12"
+	}
+	err = b.watches.Delete(ctx, watch.OwnerTelegram+strconv.FormatInt(chatID, 10), id)
+	switch {
+	case errors.Is(err, watch.ErrNotFound):
+		return "Такой подписки нет."
+	case err != nil:
+		b.logger.Error("delete telegram watch", "chat", chatID, "id", id, "error", err)
+		return "Не удалось удалить подписку, попробуйте позже."
+	}
+	return fmt.Sprintf("Подписка %d удалена.", id)
+}
+
+// Channel makes the scheduler route the alerts of Telegram chats to the bot.
+func (b *Bot) Channel() string {
+	return watch.OwnerTelegram
+}
+
+// Notify sends alerts of subscriptions made through the bot to their chats and
+// ignores the others.
+func (b *Bot) Notify(ctx context.Context, alert watch.Alert) error {
+	chat, ok := strings.CutPrefix(alert.Subscription.Owner, watch.OwnerTelegram)
+	if !ok {
+		return nil
+	}
+	chatID, err := strconv.ParseInt(chat, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid telegram owner %q", alert.Subscription.Owner)
+	}
+	_, err = b.api.SendMessage(ctx, chatID, formatAlert(alert, b.options.Labels), nil)
+	return err
+}
@@ -0,0 +1,209 @@
+package telegram
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"agregator/internal/product"
+	"agregator/internal/search"
+	"agregator/internal/watch"
+)
+
+// fakeAPI is a Bot API server that hands out queued updates and records the
+// calls of other methods.
+type fakeAPI struct {
+	mu      sync.Mutex
+	updates []Update
+	calls   []apiCall
+	called  chan struct{}
+}
+
+type apiCall struct {
+	method string
+	params map[string]any
+}
+
+func newFakeAPI(t *testing.T) (*fakeAPI, *Client) {
+	api := &fakeAPI{called: make(chan struct{}, 100)}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, ok := strings.CutPrefix(r.URL.Path, "/bottoken/")
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		var params map[string]any
+		json.NewDecoder(r.Body).Decode(&params)
+
+		api.mu.Lock()
+		var result any = true
+		switch method {
+		case "getUpdates":
+			result, api.updates = api.updates, nil
+		case "sendMessage":
+			result = Message{MessageID: int64(len(api.calls) + 100), Chat: Chat{ID: int64(params["chat_id"].(float64))}}
+		}
+		if method != "getUpdates" {
+			api.calls = append(api.calls, apiCall{method: method, params: params})
+		}
+		api.mu.Unlock()
+
+		if method == "getUpdates" && result == nil {
+			time.Sleep(10 * time.Millisecond)
+		}
+		json.NewEncoder(w).Encode(map[string]any{"ok": true, "result": result})
+		if method != "getUpdates" {
+			api.called <- struct{}{}
+		}
+	}))
+	t.Cleanup(server.Close)
+	return api, NewClient(server.URL+"/", "token")
+}
+
+func (a *fakeAPI) push(updates ...Update) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.updates = append(a.updates, updates...)
+}
+
+// wait returns the next n calls.
+func (a *fakeAPI) wait(t *testing.T, n int) []apiCall {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		select {
+		case <-a.called:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("got %d of %d API calls", i, n)
+		}
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	calls := a.calls[len(a.calls)-n:]
+	return calls
+}
+
+type fakeMarketplace struct{}
+
+func (fakeMarketplace) Name() string {
+	return "wb"
+}
+
+func (fakeMarketplace) Search(context.Context, string) ([]product.Product, error) {
+	var products []product.Product
+	for i := 1; i <= 7; i++ {
+		products = append(products, product.Product{
+			Marketplace:          "wb",
+			ProductID:            fmt.Sprint(i),
+			ProductName:          fmt.Sprintf("Phone <%d>", i),
+			Link:                 fmt.Sprintf("https://example.com/%d", i),
+			DiscountPriceKopecks: int64(i) * 100_000,
+			BasePriceKopecks:     int64(i) * 150_000,
+			ProductStars:         "4,8",
+			ProductReviews:       "12 отзывов",
+		})
+	}
+	return products, nil
+}
+
+func newTestBot(t *testing.T) (*fakeAPI, *Bot, *watch.Store) {
+	t.Helper()
+	api, client := newFakeAPI(t)
+	store, err := watch.Open(filepath.Join(t.TempDir(), "watch.db"))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	service := search.New(slog.Default(), nil, fakeMarketplace{})
+	bot := NewBot(slog.Default(), client, service, store, Options{PageSize: 3, Labels: map[string]string{"wb": "Wildberries"}})
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go bot.Run(ctx)
+	return api, bot, store
+}
+
+func message(id int64, text string) Update {
+	return Update{UpdateID: id, Message: &Message{MessageID: id, Chat: Chat{ID: 42}, Text: text}}
+}
+
+func TestBotSearchesAndPages(t *testing.T) {
+	api, _, _ := newTestBot(t)
+
+	api.push(message(1, "Phone"))
+	sent := api.wait(t, 1)[0]
+	text := sent.params["text"].(string)
+	for _, want := range []string{"<b>phone</b> — найдено 7, стр. 1 из 3", `<a href="https://example.com/1">Phone &lt;1&gt;</a>`, "<b>1 000 ₽</b> <s>1 500 ₽</s> · ★ 4.8 (12) · Wildberries"} {
+		if !strings.Contains(text, want) {
+			t.Fatalf("message = %s, missing %q", text, want)
+		}
+	}
+	if strings.Contains(text, "example.com/4") {
+		t.Fatalf("first page contains the fourth offer: %s", text)
+	}
+	markup, _ := json.Marshal(sent.params["reply_markup"])
+	if !strings.Contains(string(markup), `"callback_data":"p:1:price_asc"`) || !strings.Contains(string(markup), `"callback_data":"p:0:price_desc"`) {
+		t.Fatalf("keyboard = %s", markup)
+	}
+
+	// Message IDs of the fake API start at 100 plus the number of calls.
+	api.push(Update{UpdateID: 2, CallbackQuery: &CallbackQuery{ID: "c1", Data: "p:0:price_desc", Message: &Message{MessageID: 100, Chat: Chat{ID: 42}}}})
+	calls := api.wait(t, 2)
+	if calls[0].method != "editMessageText" || calls[1].method != "answerCallbackQuery" {
+		t.Fatalf("calls = %v, want edit and answer", calls)
+	}
+	if edited := calls[0].params["text"].(string); !strings.Contains(edited, "example.com/7") || calls[0].params["message_id"].(float64) != 100 {
+		t.Fatalf("edited message = %v", calls[0].params)
+	}
+
+	api.push(Update{UpdateID: 3, CallbackQuery: &CallbackQuery{ID: "c2", Data: "p:1:price_asc", Message: &Message{MessageID: 999, Chat: Chat{ID: 42}}}})
+	if answer := api.wait(t, 1)[0]; answer.method != "answerCallbackQuery" || answer.params["text"] != expiredAnswer {
+		t.Fatalf("answer for unknown message = %v", answer)
+	}
+}
+
+func TestBotManagesWatches(t *testing.T) {
+	api, bot, store := newTestBot(t)
+
+	api.push(message(1, "/watch 1500,50 iPhone 15"))
+	if text := api.wait(t, 1)[0].params["text"].(string); !strings.Contains(text, "«iphone 15», не дороже 1 500,5 ₽") {
+		t.Fatalf("watch reply = %s", text)
+	}
+	api.push(message(2, "/watch -10% tv"))
+	api.wait(t, 1)
+	api.push(message(3, "/watch cheap"))
+	if text := api.wait(t, 1)[0].params["text"].(string); text != watchUsage {
+		t.Fatalf("invalid watch reply = %s", text)
+	}
+
+	subs, _ := store.List(context.Background(), "telegram:42")
+	if len(subs) != 2 || subs[0].TargetPriceKopecks != 150_050 || subs[1].DropPercent != 10 {
+		t.Fatalf("subscriptions = %#v", subs)
+	}
+
+	api.push(message(4, fmt.Sprintf("/unwatch %d", subs[0].ID)))
+	api.wait(t, 1)
+	api.push(message(5, "/watches"))
+	if text := api.wait(t, 1)[0].params["text"].(string); strings.Contains(text, "iphone") || !strings.Contains(text, "снижение на 10%") {
+		t.Fatalf("watches reply = %s", text)
+	}
+
+	alert := watch.Alert{Subscription: subs[1], Product: product.Product{Marketplace: "wb", ProductName: "TV", DiscountPriceKopecks: 900_000}, Reason: watch.ReasonDrop, ReferencePriceKopecks: 1_000_000}
+	if err := bot.Notify(context.Background(), alert); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+	sent := api.wait(t, 1)[0]
+	if sent.params["chat_id"].(float64) != 42 || !strings.Contains(sent.params["text"].(string), "Было: 10 000 ₽") {
+		t.Fatalf("alert message = %v", sent.params)
+	}
+	alert.Subscription.Owner = "someone-else"
+	if err := bot.Notify(context.Background(), alert); err != nil {
+		t.Fatalf("Notify() for another owner error = %v", err)
+	}
+}
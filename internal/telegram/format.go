@@ -0,0 +1,141 @@
+package telegram
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"strings"
+
+	"agregator/internal/product"
+	"agregator/internal/search"
+	"agregator/internal/watch"
+)
+
+const helpText = `Отправьте название товара, и бот покажет самые дешёвые предложения Ozon и Wildberries.
+
+/watch 50000 iphone 15 — сообщить, когда цена станет не выше 50 000 ₽
+/watch -10% iphone 15 — сообщить, когда цена упадёт на 10%
+/watches — список подписок
+/unwatch 12 — удалить подписку`
+
+const watchUsage = "Формат: /watch 50000 iphone 15 или /watch -10% iphone 15"
+
+var sortButtons = []struct {
+	order search.SortOrder
+	label string
+}{
+	{search.SortPriceAsc, "Дешевле"},
+	{search.SortPriceDesc, "Дороже"},
+	{search.SortRating, "Рейтинг"},
+	{search.SortDiscountPercent, "Скидка"},
+}
+
+func formatResults(query string, products []product.Product, first, total, page, pages int, partial bool, labels map[string]string) string {
+	var text strings.Builder
+	fmt.Fprintf(&text, "<b>%s</b> — найдено %d, стр. %d из %d\n", html.EscapeString(query), total, page+1, pages)
+	if partial {
+		text.WriteString("<i>Часть маркетплейсов не ответила, список может быть неполным.</i>\n")
+	}
+	for i, p := range products {
+		fmt.Fprintf(&text, "\n%d. %s\n%s\n", first+i+1, formatName(p), formatOffer(p, labels))
+	}
+	return text.String()
+}
+
+func formatName(p product.Product) string {
+	name := html.EscapeString(p.ProductName)
+	if name == "" {
+		name = "Товар"
+	}
+	if p.Link == "" {
+		return name
+	}
+	return fmt.Sprintf(`<a href="%s">%s</a>`, html.EscapeString(p.Link), name)
+}
+
+// formatOffer renders the price, rating and marketplace of an offer.
+func formatOffer(p product.Product, labels map[string]string) string {
+	parts := []string{"<b>" + product.FormatPrice(p.DiscountPriceKopecks) + "</b>"}
+	if p.DiscountPercent() > 0 {
+		parts[0] += " <s>" + product.FormatPrice(p.BasePriceKopecks) + "</s>"
+	}
+	if rating, ok := p.Rating(); ok {
+		stars := fmt.Sprintf("★ %.1f", rating)
+		if reviews, ok := p.ReviewCount(); ok {
+			stars += fmt.Sprintf(" (%d)", reviews)
+		}
+		parts = append(parts, stars)
+	}
+	if p.PriceCheck != nil && p.PriceCheck.Verdict == product.VerdictFake {
+		parts = append(parts, "скидка завышена")
+	}
+	if label := marketplaceLabel(p.Marketplace, labels); label != "" {
+		parts = append(parts, html.EscapeString(label))
+	}
+	return strings.Join(parts, " · ")
+}
+
+func marketplaceLabel(name string, labels map[string]string) string {
+	if label, ok := labels[name]; ok {
+		return label
+	}
+	return name
+}
+
+func keyboard(page, pages int, order search.SortOrder) *InlineKeyboardMarkup {
+	var navigation []InlineKeyboardButton
+	if page > 0 {
+		navigation = append(navigation, InlineKeyboardButton{Text: "◀", CallbackData: callbackData(page-1, order)})
+	}
+	if page < pages-1 {
+		navigation = append(navigation, InlineKeyboardButton{Text: "▶", CallbackData: callbackData(page+1, order)})
+	}
+	var sorting []InlineKeyboardButton
+	for _, button := range sortButtons {
+		label := button.label
+		if button.order == order {
+			label = "• " + label
+		}
+		sorting = append(sorting, InlineKeyboardButton{Text: label, CallbackData: callbackData(0, button.order)})
+	}
+	rows := [][]InlineKeyboardButton{sorting}
+	if len(navigation) > 0 {
+		rows = append([][]InlineKeyboardButton{navigation}, rows...)
+	}
+	return &InlineKeyboardMarkup{InlineKeyboard: rows}
+}
+
+func callbackData(page int, order search.SortOrder) string {
+	return fmt.Sprintf("p:%d:%s", page, order)
+}
+
+func searchErrorText(err error) string {
+	switch {
+	case errors.Is(err, search.ErrProductsNotFound):
+		return "Ничего не найдено."
+	case errors.Is(err, search.ErrRateLimited):
+		return "Маркетплейсы временно ограничили запросы, попробуйте через минуту."
+	default:
+		return "Не удалось выполнить поиск, попробуйте позже."
+	}
+}
+
+func describeWatch(sub watch.Subscription) string {
+	var threshold string
+	if sub.TargetPriceKopecks > 0 {
+		threshold = "не дороже " + product.FormatPrice(sub.TargetPriceKopecks)
+	} else {
+		threshold = fmt.Sprintf("снижение на %g%%", sub.DropPercent)
+	}
+	return fmt.Sprintf("«%s», %s", html.EscapeString(sub.Query), threshold)
+}
+
+func formatAlert(alert watch.Alert, labels map[string]string) string {
+	query := html.EscapeString(alert.Subscription.Query)
+	if alert.Reason == watch.ReasonOutOfStock {
+		return fmt.Sprintf("Товар по подписке %d «%s» пропал из продажи.", alert.Subscription.ID, query)
+	}
+	return fmt.Sprintf("Цена снизилась — подписка %d «%s»\n\n%s\n%s\nБыло: %s",
+		alert.Subscription.ID, query, formatName(alert.Product), formatOffer(alert.Product, labels),
+		product.FormatPrice(alert.ReferencePriceKopecks))
+}
@@ -0,0 +1,180 @@
+package watch
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"agregator/internal/search"
+)
+
+// maxBackoff limits how long the subscriptions of a failing marketplace are
+// skipped.
+const maxBackoff = 6 * time.Hour
+
+// Scheduler periodically searches the watched queries and notifies owners of
+// price drops. It only checks the subscriptions of owners its notifier serves,
+// so that a process without a Telegram bot does not mark the alerts of
+// Telegram chats as sent. Only one replica should run a scheduler for the
+// same notifiers, otherwise alerts are sent once per replica.
+type Scheduler struct {
+	store    *Store
+	search   *search.Service
+	notifier Notifier
+	interval time.Duration
+	logger   *slog.Logger
+	now      func() time.Time
+
+	failing map[string]backoff // by marketplace
+}
+
+type backoff struct {
+	failures int
+	until    time.Time
+}
+
+func NewScheduler(logger *slog.Logger, store *Store, searchService *search.Service, notifier Notifier, interval time.Duration) *Scheduler {
+	return &Scheduler{
+		logger:   logger,
+		store:    store,
+		search:   searchService,
+		notifier: notifier,
+		interval: interval,
+		now:      time.Now,
+		failing:  make(map[string]backoff),
+	}
+}
+
+// Run checks the subscriptions every interval until ctx is done.
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		if err := s.Check(ctx); err != nil {
+			s.logger.Error("check subscriptions", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check runs one pass over the subscriptions. Each query is searched once for
+// all its subscribers. The subscriptions of a failing marketplace are retried
+// with an exponential backoff instead of every interval, while the other
+// marketplaces of the same query are still checked.
+func (s *Scheduler) Check(ctx context.Context) error {
+	subs, err := s.store.List(ctx, "")
+	if err != nil {
+		return err
+	}
+	now := s.now()
+	byQuery := make(map[string][]Subscription)
+	var queries []string
+	for _, sub := range subs {
+		if !Serves(s.notifier, sub.Owner) || !s.due(sub, now) {
+			continue
+		}
+		if _, ok := byQuery[sub.Query]; !ok {
+			queries = append(queries, sub.Query)
+		}
+		byQuery[sub.Query] = append(byQuery[sub.Query], sub)
+	}
+
+	// A marketplace that failed any query of the pass counts as failing. It is
+	// still searched for the other marketplaces of its queries, but only a
+	// success changes its backoff until the backoff is over.
+	failed := make(map[string]bool)
+	for _, query := range queries {
+		if ctx.Err() != nil {
+			break
+		}
+		for marketplace, f := range s.checkQuery(ctx, query, byQuery[query]) {
+			failed[marketplace] = failed[marketplace] || f
+		}
+	}
+	for marketplace, f := range failed {
+		switch {
+		case !f:
+			delete(s.failing, marketplace)
+		case !now.Before(s.failing[marketplace].until):
+			s.fail(marketplace)
+		}
+	}
+	return ctx.Err()
+}
+
+// due reports whether sub is checked in this pass: a subscription to one
+// marketplace waits for its backoff, any other while at least one marketplace
+// is not backing off.
+func (s *Scheduler) due(sub Subscription, now time.Time) bool {
+	if sub.Marketplace != "" {
+		return !now.Before(s.failing[sub.Marketplace].until)
+	}
+	for _, marketplace := range s.search.Marketplaces() {
+		if !now.Before(s.failing[marketplace].until) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkQuery checks the subscriptions of query and returns whether each
+// marketplace failed.
+func (s *Scheduler) checkQuery(ctx context.Context, query string, subs []Subscription) map[string]bool {
+	failed := make(map[string]bool)
+	result, err := s.search.Search(ctx, query, search.Options{})
+	if err != nil && !errors.Is(err, search.ErrProductsNotFound) {
+		s.logger.Warn("watched query failed", "query", query, "error", err)
+		for _, marketplace := range s.search.Marketplaces() {
+			failed[marketplace] = true
+		}
+		return failed
+	}
+	var anyFailed bool
+	for _, source := range result.Sources {
+		failed[source.Marketplace] = source.Status != search.StatusOK
+		anyFailed = anyFailed || failed[source.Marketplace]
+	}
+
+	now := s.now()
+	for _, sub := range subs {
+		var (
+			updated Subscription
+			alert   *Alert
+		)
+		if offer, ok := sub.Offer(result.Products); ok {
+			updated, alert = sub.check(offer, now)
+		} else if err != nil || failed[sub.Marketplace] || (sub.Marketplace == "" && anyFailed) {
+			// The offer may be missing only because its marketplace failed.
+			// An empty result does not tell which marketplaces answered.
+			continue
+		} else {
+			updated, alert = sub.missing(now)
+		}
+		if alert != nil {
+			if err := s.notifier.Notify(ctx, *alert); err != nil {
+				s.logger.Error("notify subscriber", "subscription", sub.ID, "error", err)
+				updated.AlertedPriceKopecks, updated.OutOfStock = sub.AlertedPriceKopecks, sub.OutOfStock
+			} else {
+				s.logger.Info("subscriber notified", "subscription", sub.ID, "owner", sub.Owner, "price", alert.Product.DiscountPriceKopecks, "reason", alert.Reason)
+			}
+		}
+		if err := s.store.saveState(ctx, updated); err != nil {
+			s.logger.Error("save subscription state", "subscription", sub.ID, "error", err)
+		}
+	}
+	return failed
+}
+
+func (s *Scheduler) fail(marketplace string) {
+	b := s.failing[marketplace]
+	b.failures++
+	delay := min(s.interval<<min(b.failures, 16), maxBackoff)
+	b.until = s.now().Add(delay)
+	s.failing[marketplace] = b
+	s.logger.Warn("watched marketplace failed", "marketplace", marketplace, "failures", b.failures, "retry_in", delay)
+}
@@ -0,0 +1,288 @@
+package watch
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"agregator/internal/product"
+	"agregator/internal/search"
+)
+
+type priceMarketplace struct {
+	mu    sync.Mutex
+	price int64
+	err   error
+	calls int
+}
+
+func (m *priceMarketplace) Name() string {
+	return "wb"
+}
+
+func (m *priceMarketplace) Search(context.Context, string) ([]product.Product, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls++
+	if m.err != nil {
+		return nil, m.err
+	}
+	return []product.Product{
+		{Marketplace: "wb", ProductID: "42", Key: "wb:42", DiscountPriceKopecks: m.price},
+		{Marketplace: "wb", ProductID: "7", Key: "wb:7", DiscountPriceKopecks: m.price * 2},
+	}, nil
+}
+
+func (m *priceMarketplace) set(price int64, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.price, m.err = price, err
+}
+
+type recordingNotifier struct {
+	alerts []Alert
+	err    error
+}
+
+func (n *recordingNotifier) Notify(_ context.Context, alert Alert) error {
+	if n.err != nil {
+		return n.err
+	}
+	n.alerts = append(n.alerts, alert)
+	return nil
+}
+
+func TestSchedulerNotifiesOncePerPrice(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+	target, _ := store.Add(ctx, Subscription{Owner: "alice", Query: "phone", Marketplace: "wb", ProductID: "7", TargetPriceKopecks: 1_500})
+	drop, _ := store.Add(ctx, Subscription{Owner: "bob", Query: "phone", DropPercent: 20})
+
+	marketplace := &priceMarketplace{price: 1_000}
+	notifier := &recordingNotifier{}
+	scheduler := NewScheduler(slog.Default(), store, search.New(slog.Default(), nil, marketplace), notifier, time.Minute)
+
+	steps := []struct {
+		price int64
+		want  []int64
+	}{
+		{price: 1_000, want: nil}, // 2000 for #7 is above the target, 1000 is the reference
+		{price: 700, want: []int64{target.ID, drop.ID}},
+		{price: 700, want: nil}, // the same price is not repeated
+		{price: 600, want: []int64{target.ID, drop.ID}},
+		{price: 1_000, want: nil}, // back above the thresholds
+		{price: 600, want: []int64{target.ID, drop.ID}},
+	}
+	for i, step := range steps {
+		marketplace.set(step.price, nil)
+		notifier.alerts = nil
+		if err := scheduler.Check(ctx); err != nil {
+			t.Fatalf("step %d: Check() error = %v", i, err)
+		}
+		var got []int64
+		for _, alert := range notifier.alerts {
+			got = append(got, alert.Subscription.ID)
+		}
+		if len(got) != len(step.want) || (len(got) == 2 && (got[0] != step.want[0] || got[1] != step.want[1])) {
+			t.Fatalf("step %d: alerts for %v, want %v", i, got, step.want)
+		}
+	}
+	if marketplace.calls != len(steps) {
+		t.Fatalf("marketplace calls = %d, want one per check", marketplace.calls)
+	}
+
+	subs, _ := store.List(ctx, "bob")
+	if subs[0].ReferencePriceKopecks != 1_000 || subs[0].AlertedPriceKopecks != 600 || subs[0].CheckedAt == nil {
+		t.Fatalf("saved state = %#v", subs[0])
+	}
+}
+
+func TestSchedulerRetriesFailedNotification(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+	store.Add(ctx, Subscription{Owner: "alice", Query: "phone", TargetPriceKopecks: 1_500})
+
+	notifier := &recordingNotifier{err: errors.New("receiver down")}
+	scheduler := NewScheduler(slog.Default(), store, search.New(slog.Default(), nil, &priceMarketplace{price: 1_000}), notifier, time.Minute)
+	if err := scheduler.Check(ctx); err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+	notifier.err = nil
+	if err := scheduler.Check(ctx); err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+	if len(notifier.alerts) != 1 {
+		t.Fatalf("alerts = %d, want the failed alert to be sent again", len(notifier.alerts))
+	}
+}
+
+type chatNotifier struct {
+	recordingNotifier
+}
+
+func (n *chatNotifier) Channel() string {
+	return OwnerTelegram
+}
+
+func TestSchedulerSkipsOwnersOfOtherNotifiers(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+	for _, owner := range []string{"telegram:1", "alice", "email:buyer@example.com"} {
+		store.Add(ctx, Subscription{Owner: owner, Query: "phone", TargetPriceKopecks: 1_500})
+	}
+	service := search.New(slog.Default(), nil, &priceMarketplace{price: 1_000})
+
+	webhooks := &recordingNotifier{}
+	if err := NewScheduler(slog.Default(), store, service, webhooks, time.Minute).Check(ctx); err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+	if len(webhooks.alerts) != 1 || webhooks.alerts[0].Subscription.Owner != "alice" {
+		t.Fatalf("webhook alerts = %#v, want only alice", webhooks.alerts)
+	}
+	for _, owner := range []string{"telegram:1", "email:buyer@example.com"} {
+		subs, _ := store.List(ctx, owner)
+		if subs[0].AlertedPriceKopecks != 0 || subs[0].CheckedAt != nil {
+			t.Fatalf("%s state saved without a notifier: %#v", owner, subs[0])
+		}
+	}
+
+	chat := &chatNotifier{}
+	if err := NewScheduler(slog.Default(), store, service, Notifiers{chat}, time.Minute).Check(ctx); err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+	if len(chat.alerts) != 1 || chat.alerts[0].Subscription.Owner != "telegram:1" {
+		t.Fatalf("chat alerts = %#v, want only telegram:1", chat.alerts)
+	}
+}
+
+func TestSchedulerBacksOffFailingMarketplaces(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+	store.Add(ctx, Subscription{Owner: "alice", Query: "phone", TargetPriceKopecks: 1_500})
+
+	marketplace := &priceMarketplace{err: errors.New("unavailable")}
+	scheduler := NewScheduler(slog.Default(), store, search.New(slog.Default(), nil, marketplace), &recordingNotifier{}, time.Minute)
+	now := time.Now()
+	scheduler.now = func() time.Time { return now }
+
+	for _, step := range []struct {
+		after time.Duration
+		calls int
+	}{
+		{after: 0, calls: 1},
+		{after: time.Minute, calls: 1},     // skipped for 2 minutes
+		{after: 2 * time.Minute, calls: 2}, // skipped for 4 minutes
+		{after: 5 * time.Minute, calls: 2},
+		{after: 6 * time.Minute, calls: 3},
+	} {
+		scheduler.now = func() time.Time { return now.Add(step.after) }
+		if err := scheduler.Check(ctx); err != nil {
+			t.Fatalf("Check() error = %v", err)
+		}
+		if marketplace.calls != step.calls {
+			t.Fatalf("after %v: calls = %d, want %d", step.after, marketplace.calls, step.calls)
+		}
+	}
+
+	marketplace.set(1_000, nil)
+	scheduler.now = func() time.Time { return now.Add(time.Hour) }
+	scheduler.Check(ctx)
+	if _, ok := scheduler.failing["wb"]; ok {
+		t.Fatal("backoff not reset after a successful search")
+	}
+}
+
+type failingMarketplace struct {
+	calls int
+}
+
+func (m *failingMarketplace) Name() string {
+	return "ozon"
+}
+
+func (m *failingMarketplace) Search(context.Context, string) ([]product.Product, error) {
+	m.calls++
+	return nil, errors.New("unavailable")
+}
+
+func TestSchedulerChecksMarketplacesThatAnswer(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+	wbSub, _ := store.Add(ctx, Subscription{Owner: "alice", Query: "phone", Marketplace: "wb", ProductID: "42", TargetPriceKopecks: 1_500})
+	ozonSub, _ := store.Add(ctx, Subscription{Owner: "bob", Query: "phone", Marketplace: "ozon", ProductID: "1", TargetPriceKopecks: 1_500})
+
+	wb := &priceMarketplace{price: 1_000}
+	ozon := &failingMarketplace{}
+	notifier := &recordingNotifier{}
+	scheduler := NewScheduler(slog.Default(), store, search.New(slog.Default(), nil, wb, ozon), notifier, time.Minute)
+	now := time.Now()
+
+	for i, price := range []int64{1_000, 600} {
+		scheduler.now = func() time.Time { return now.Add(time.Duration(i) * time.Minute) }
+		wb.set(price, nil)
+		if err := scheduler.Check(ctx); err != nil {
+			t.Fatalf("Check() error = %v", err)
+		}
+		if len(notifier.alerts) != i+1 || notifier.alerts[i].Subscription.ID != wbSub.ID {
+			t.Fatalf("check %d: alerts = %#v, want one more for the wb subscription", i, notifier.alerts)
+		}
+	}
+	if wb.calls != 2 || ozon.calls != 2 {
+		t.Fatalf("calls = wb %d, ozon %d, want the query searched on every check", wb.calls, ozon.calls)
+	}
+	if _, ok := scheduler.failing["wb"]; ok {
+		t.Fatal("wb backs off although it answered")
+	}
+	if scheduler.failing["ozon"].failures != 1 {
+		t.Fatalf("ozon backoff = %#v, want one failure while its subscriptions wait", scheduler.failing["ozon"])
+	}
+	subs, _ := store.List(ctx, "bob")
+	if len(subs) != 1 || subs[0].ID != ozonSub.ID || subs[0].CheckedAt != nil {
+		t.Fatalf("ozon subscription = %#v, want it unchecked", subs)
+	}
+}
+
+func TestSchedulerReportsOutOfStockOnce(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+	store.Add(ctx, Subscription{Owner: "alice", Query: "phone", Marketplace: "wb", ProductID: "42", TargetPriceKopecks: 500})
+
+	marketplace := &listMarketplace{products: []product.Product{{Marketplace: "wb", ProductID: "7", DiscountPriceKopecks: 1_000}}}
+	notifier := &recordingNotifier{}
+	scheduler := NewScheduler(slog.Default(), store, search.New(slog.Default(), nil, marketplace), notifier, time.Minute)
+
+	for range 2 {
+		if err := scheduler.Check(ctx); err != nil {
+			t.Fatalf("Check() error = %v", err)
+		}
+	}
+	if len(notifier.alerts) != 1 || notifier.alerts[0].Reason != ReasonOutOfStock {
+		t.Fatalf("alerts = %#v, want one out_of_stock", notifier.alerts)
+	}
+
+	marketplace.products = append(marketplace.products, product.Product{Marketplace: "wb", ProductID: "42", DiscountPriceKopecks: 400})
+	if err := scheduler.Check(ctx); err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+	if len(notifier.alerts) != 2 || notifier.alerts[1].Reason != ReasonTarget {
+		t.Fatalf("alerts = %#v, want a target_price alert after restock", notifier.alerts)
+	}
+	if subs, _ := store.List(ctx, "alice"); subs[0].OutOfStock {
+		t.Fatal("out_of_stock not reset after restock")
+	}
+}
+
+type listMarketplace struct {
+	products []product.Product
+}
+
+func (m *listMarketplace) Name() string {
+	return "wb"
+}
+
+func (m *listMarketplace) Search(context.Context, string) ([]product.Product, error) {
+	return m.products, nil
+}
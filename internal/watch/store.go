@@ -0,0 +1,146 @@
+package watch
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+var ErrNotFound = errors.New("subscription not found")
+
+const schema = `
+CREATE TABLE IF NOT EXISTS subscriptions (
+	id              INTEGER PRIMARY KEY AUTOINCREMENT,
+	owner           TEXT    NOT NULL,
+	query           TEXT    NOT NULL,
+	marketplace     TEXT    NOT NULL DEFAULT '',
+	product_id      TEXT    NOT NULL DEFAULT '',
+	target_price    INTEGER NOT NULL DEFAULT 0,
+	drop_percent    REAL    NOT NULL DEFAULT 0,
+	reference_price INTEGER NOT NULL DEFAULT 0,
+	alerted_price   INTEGER NOT NULL DEFAULT 0,
+	out_of_stock    INTEGER NOT NULL DEFAULT 0,
+	created_at      INTEGER NOT NULL,
+	checked_at      INTEGER NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS subscriptions_owner ON subscriptions (owner);
+`
+
+const columns = `id, owner, query, marketplace, product_id, target_price, drop_percent, reference_price, alerted_price, out_of_stock, created_at, checked_at`
+
+// Store keeps subscriptions in SQLite.
+type Store struct {
+	db  *sql.DB
+	now func() time.Time
+}
+
+// Open opens the database at path, creating it if needed.
+func Open(path string) (*Store, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, fmt.Errorf("open watchlist: %w", err)
+	}
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("create watchlist schema: %w", err)
+	}
+	return &Store{db: db, now: time.Now}, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Add validates and stores a new subscription.
+func (s *Store) Add(ctx context.Context, sub Subscription) (Subscription, error) {
+	sub, err := sub.normalize()
+	if err != nil {
+		return Subscription{}, err
+	}
+	sub.CreatedAt = s.now().UTC().Truncate(time.Millisecond)
+	sub.ReferencePriceKopecks, sub.AlertedPriceKopecks, sub.OutOfStock, sub.CheckedAt = 0, 0, false, nil
+	result, err := s.db.ExecContext(ctx, `
+		INSERT INTO subscriptions (owner, query, marketplace, product_id, target_price, drop_percent, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		sub.Owner, sub.Query, sub.Marketplace, sub.ProductID, sub.TargetPriceKopecks, sub.DropPercent, sub.CreatedAt.UnixMilli())
+	if err != nil {
+		return Subscription{}, fmt.Errorf("add subscription: %w", err)
+	}
+	if sub.ID, err = result.LastInsertId(); err != nil {
+		return Subscription{}, fmt.Errorf("add subscription: %w", err)
+	}
+	return sub, nil
+}
+
+// List returns the subscriptions of owner, or every subscription when owner is
+// empty, oldest first.
+func (s *Store) List(ctx context.Context, owner string) ([]Subscription, error) {
+	query := `SELECT ` + columns + ` FROM subscriptions`
+	var args []any
+	if owner != "" {
+		query += ` WHERE owner = ?`
+		args = append(args, owner)
+	}
+	rows, err := s.db.QueryContext(ctx, query+` ORDER BY id`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list subscriptions: %w", err)
+	}
+	defer rows.Close()
+
+	subs := []Subscription{}
+	for rows.Next() {
+		var (
+			sub                  Subscription
+			createdAt, checkedAt int64
+		)
+		err := rows.Scan(&sub.ID, &sub.Owner, &sub.Query, &sub.Marketplace, &sub.ProductID, &sub.TargetPriceKopecks,
+			&sub.DropPercent, &sub.ReferencePriceKopecks, &sub.AlertedPriceKopecks, &sub.OutOfStock, &createdAt, &checkedAt)
+		if err != nil {
+			return nil, fmt.Errorf("list subscriptions: %w", err)
+		}
+		sub.CreatedAt = time.UnixMilli(createdAt).UTC()
+		if checkedAt != 0 {
+			checked := time.UnixMilli(checkedAt).UTC()
+			sub.CheckedAt = &checked
+		}
+		subs = append(subs, sub)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list subscriptions: %w", err)
+	}
+	return subs, nil
+}
+
+// Delete removes a subscription of owner.
+func (s *Store) Delete(ctx context.Context, owner string, id int64) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM subscriptions WHERE id = ? AND owner = ?`, id, owner)
+	if err != nil {
+		return fmt.Errorf("delete subscription: %w", err)
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("delete subscription: %w", err)
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// saveState stores what the scheduler learned about a subscription.
+func (s *Store) saveState(ctx context.Context, sub Subscription) error {
+	var checkedAt int64
+	if sub.CheckedAt != nil {
+		checkedAt = sub.CheckedAt.UnixMilli()
+	}
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE subscriptions SET reference_price = ?, alerted_price = ?, out_of_stock = ?, checked_at = ? WHERE id = ?`,
+		sub.ReferencePriceKopecks, sub.AlertedPriceKopecks, sub.OutOfStock, checkedAt, sub.ID)
+	if err != nil {
+		return fmt.Errorf("save subscription %d: %w", sub.ID, err)
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package watch
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+	store, err := Open(filepath.Join(t.TempDir(), "watch.db"))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	return store
+}
+
+func TestStoreAddListDelete(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+
+	added, err := store.Add(ctx, Subscription{Owner: "alice", Query: " iPhone  15 ", Marketplace: "WB", ProductID: "42", TargetPriceKopecks: 100_000})
+	if err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if added.ID == 0 || added.Query != "iphone 15" || added.Marketplace != "wb" || added.CreatedAt.IsZero() {
+		t.Fatalf("Add() = %#v", added)
+	}
+	if _, err := store.Add(ctx, Subscription{Owner: "bob", Query: "tv", DropPercent: 10}); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	for name, sub := range map[string]Subscription{
+		"no owner":        {Query: "tv", DropPercent: 10},
+		"no query":        {Owner: "alice", DropPercent: 10},
+		"no threshold":    {Owner: "alice", Query: "tv"},
+		"bad percent":     {Owner: "alice", Query: "tv", DropPercent: 100},
+		"product only id": {Owner: "alice", Query: "tv", ProductID: "1", DropPercent: 10},
+	} {
+		if _, err := store.Add(ctx, sub); err == nil {
+			t.Fatalf("%s: Add() error = nil", name)
+		}
+	}
+
+	subs, err := store.List(ctx, "alice")
+	if err != nil || len(subs) != 1 || subs[0].ID != added.ID || !subs[0].CreatedAt.Equal(added.CreatedAt) {
+		t.Fatalf("List() = %#v, %v", subs, err)
+	}
+	if all, err := store.List(ctx, ""); err != nil || len(all) != 2 {
+		t.Fatalf("List() all = %#v, %v", all, err)
+	}
+
+	if err := store.Delete(ctx, "bob", added.ID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Delete() of another owner error = %v, want ErrNotFound", err)
+	}
+	if err := store.Delete(ctx, "alice", added.ID); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if subs, _ := store.List(ctx, "alice"); len(subs) != 0 {
+		t.Fatalf("List() after Delete() = %#v", subs)
+	}
+}
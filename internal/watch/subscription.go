@@ -0,0 +1,190 @@
+package watch
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"agregator/internal/product"
+	"agregator/internal/search"
+)
+
+// Subscription asks to be notified when the price of an offer drops. With
+// Marketplace and ProductID it watches one offer found by Query, otherwise the
+// cheapest offer of Query, optionally limited to Marketplace.
+//
+// An alert fires when the discount price is at most TargetPriceKopecks or has
+// dropped by DropPercent from ReferencePriceKopecks, the price seen by the
+// first check. OutOfStock is set after the owner was told that the offer
+// disappeared.
+type Subscription struct {
+	ID                    int64      `json:"id"`
+	Owner                 string     `json:"owner"`
+	Query                 string     `json:"query"`
+	Marketplace           string     `json:"marketplace,omitempty"`
+	ProductID             string     `json:"product_id,omitempty"`
+	TargetPriceKopecks    int64      `json:"target_price,omitempty"`
+	DropPercent           float64    `json:"drop_percent,omitempty"`
+	ReferencePriceKopecks int64      `json:"reference_price,omitempty"`
+	AlertedPriceKopecks   int64      `json:"alerted_price,omitempty"`
+	OutOfStock            bool       `json:"out_of_stock"`
+	CreatedAt             time.Time  `json:"created_at"`
+	CheckedAt             *time.Time `json:"checked_at,omitempty"`
+}
+
+func (s Subscription) normalize() (Subscription, error) {
+	s.Owner = strings.TrimSpace(s.Owner)
+	s.Query = search.NormalizeQuery(s.Query)
+	s.Marketplace = strings.ToLower(strings.TrimSpace(s.Marketplace))
+	s.ProductID = strings.TrimSpace(s.ProductID)
+	switch {
+	case s.Owner == "":
+		return Subscription{}, errors.New("owner is required")
+	case s.Query == "":
+		return Subscription{}, errors.New("query is required")
+	case s.ProductID != "" && s.Marketplace == "":
+		return Subscription{}, errors.New("product_id requires marketplace")
+	case s.TargetPriceKopecks < 0:
+		return Subscription{}, errors.New("target_price must not be negative")
+	case s.DropPercent < 0 || s.DropPercent >= 100:
+		return Subscription{}, errors.New("drop_percent must be from 0 to 100")
+	case s.TargetPriceKopecks == 0 && s.DropPercent == 0:
+		return Subscription{}, errors.New("target_price or drop_percent is required")
+	}
+	return s, nil
+}
+
+// Offer finds the watched offer in products sorted by price.
+func (s Subscription) Offer(products []product.Product) (product.Product, bool) {
+	for _, p := range products {
+		if s.Marketplace != "" && p.Marketplace != s.Marketplace {
+			continue
+		}
+		if s.ProductID == "" || p.ProductID == s.ProductID {
+			return p, true
+		}
+	}
+	return product.Product{}, false
+}
+
+// Alert reasons.
+const (
+	ReasonTarget     = "target_price"
+	ReasonDrop       = "price_drop"
+	ReasonOutOfStock = "out_of_stock"
+)
+
+// Alert tells the owner of a subscription that the price has dropped or that
+// the offer is no longer found.
+type Alert struct {
+	Subscription          Subscription    `json:"subscription"`
+	Product               product.Product `json:"product"`
+	Reason                string          `json:"reason"`
+	ReferencePriceKopecks int64           `json:"reference_price"`
+	At                    time.Time       `json:"at"`
+}
+
+// Notifier delivers alerts.
+type Notifier interface {
+	Notify(ctx context.Context, alert Alert) error
+}
+
+// Owner prefixes of channels with notifiers of their own. Alerts of other
+// owners, such as the users of a frontend calling the HTTP API, go to
+// webhooks.
+const (
+	OwnerTelegram = "telegram:"
+	OwnerEmail    = "email:"
+)
+
+var channels = []string{OwnerTelegram, OwnerEmail}
+
+// ChannelNotifier delivers the alerts of the owners starting with Channel,
+// one of the owner prefixes.
+type ChannelNotifier interface {
+	Notifier
+	Channel() string
+}
+
+// Serves reports whether n delivers alerts to owner. A ChannelNotifier serves
+// the owners of its channel, any other notifier the owners outside channels.
+func Serves(n Notifier, owner string) bool {
+	switch n := n.(type) {
+	case Notifiers:
+		for _, notifier := range n {
+			if Serves(notifier, owner) {
+				return true
+			}
+		}
+		return false
+	case ChannelNotifier:
+		return strings.HasPrefix(owner, n.Channel())
+	default:
+		for _, channel := range channels {
+			if strings.HasPrefix(owner, channel) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Notifiers sends every alert to each notifier that serves its owner.
+type Notifiers []Notifier
+
+func (n Notifiers) Notify(ctx context.Context, alert Alert) error {
+	var errs []error
+	for _, notifier := range n {
+		if !Serves(notifier, alert.Subscription.Owner) {
+			continue
+		}
+		if err := notifier.Notify(ctx, alert); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// check compares the offer with the subscription and returns the alert to send,
+// if any, and the subscription with the updated state. An alert is sent once
+// per price: it repeats only if the price drops further, or after the price has
+// risen above the thresholds and dropped again.
+func (s Subscription) check(offer product.Product, now time.Time) (Subscription, *Alert) {
+	price := offer.DiscountPriceKopecks
+	s.CheckedAt = &now
+	s.OutOfStock = false
+	if s.ReferencePriceKopecks == 0 {
+		s.ReferencePriceKopecks = price
+	}
+
+	var reason string
+	switch {
+	case s.TargetPriceKopecks > 0 && price <= s.TargetPriceKopecks:
+		reason = ReasonTarget
+	case s.DropPercent > 0 && float64(price) <= float64(s.ReferencePriceKopecks)*(1-s.DropPercent/100):
+		reason = ReasonDrop
+	}
+	if reason == "" {
+		s.AlertedPriceKopecks = 0
+		return s, nil
+	}
+	if s.AlertedPriceKopecks != 0 && price >= s.AlertedPriceKopecks {
+		return s, nil
+	}
+	s.AlertedPriceKopecks = price
+	return s, &Alert{Subscription: s, Product: offer, Reason: reason, ReferencePriceKopecks: s.ReferencePriceKopecks, At: now}
+}
+
+// missing reports once that the offer is no longer found, although its
+// marketplace answered.
+func (s Subscription) missing(now time.Time) (Subscription, *Alert) {
+	s.CheckedAt = &now
+	if s.OutOfStock {
+		return s, nil
+	}
+	s.OutOfStock = true
+	s.AlertedPriceKopecks = 0
+	offer := product.Product{Marketplace: s.Marketplace, ProductID: s.ProductID}
+	return s, &Alert{Subscription: s, Product: offer, Reason: ReasonOutOfStock, ReferencePriceKopecks: s.ReferencePriceKopecks, At: now}
+}
@@ -0,0 +1,96 @@
+package webhook
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// DeadLetter is an event that could not be delivered.
+type DeadLetter struct {
+	Event    Event     `json:"event"`
+	Attempts int       `json:"attempts"`
+	Error    string    `json:"error"`
+	FailedAt time.Time `json:"failed_at"`
+}
+
+type DeadLetterStore interface {
+	Save(ctx context.Context, letter DeadLetter) error
+}
+
+const deadLetterSchema = `
+CREATE TABLE IF NOT EXISTS dead_letters (
+	id        INTEGER PRIMARY KEY AUTOINCREMENT,
+	event     TEXT    NOT NULL,
+	attempts  INTEGER NOT NULL,
+	error     TEXT    NOT NULL,
+	failed_at INTEGER NOT NULL
+);
+`
+
+// DeadLetters keeps undelivered events in SQLite.
+type DeadLetters struct {
+	db *sql.DB
+}
+
+// OpenDeadLetters opens the database at path, creating it if needed.
+func OpenDeadLetters(path string) (*DeadLetters, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, fmt.Errorf("open dead letters: %w", err)
+	}
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(deadLetterSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("create dead letters schema: %w", err)
+	}
+	return &DeadLetters{db: db}, nil
+}
+
+func (s *DeadLetters) Close() error {
+	return s.db.Close()
+}
+
+func (s *DeadLetters) Save(ctx context.Context, letter DeadLetter) error {
+	event, err := json.Marshal(letter.Event)
+	if err != nil {
+		return fmt.Errorf("encode dead letter: %w", err)
+	}
+	_, err = s.db.ExecContext(ctx, `INSERT INTO dead_letters (event, attempts, error, failed_at) VALUES (?, ?, ?, ?)`,
+		string(event), letter.Attempts, letter.Error, letter.FailedAt.UnixMilli())
+	if err != nil {
+		return fmt.Errorf("save dead letter: %w", err)
+	}
+	return nil
+}
+
+// List returns up to limit dead letters, newest first.
+func (s *DeadLetters) List(ctx context.Context, limit int) ([]DeadLetter, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT event, attempts, error, failed_at FROM dead_letters ORDER BY id DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("list dead letters: %w", err)
+	}
+	defer rows.Close()
+
+	var letters []DeadLetter
+	for rows.Next() {
+		var (
+			letter   DeadLetter
+			event    string
+			failedAt int64
+		)
+		if err := rows.Scan(&event, &letter.Attempts, &letter.Error, &failedAt); err != nil {
+			return nil, fmt.Errorf("list dead letters: %w", err)
+		}
+		if err := json.Unmarshal([]byte(event), &letter.Event); err != nil {
+			return nil, fmt.Errorf("decode dead letter: %w", err)
+		}
+		letter.FailedAt = time.UnixMilli(failedAt).UTC()
+		letters = append(letters, letter)
+	}
+	return letters, rows.Err()
+}
@@ -0,0 +1,207 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var metrics = expvar.NewMap("webhook")
+
+// Event types.
+const (
+	EventPriceDrop    = "price_drop"
+	EventOutOfStock   = "out_of_stock"
+	EventParserBroken = "parser_broken"
+)
+
+// Headers of every delivery. The signature is the hex HMAC-SHA256 of
+// "<timestamp>.<body>" with the shared secret, prefixed with "sha256=".
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderID        = "X-Webhook-ID"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// Event is the body of a delivery.
+type Event struct {
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+func NewEvent(eventType string, data any) (Event, error) {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return Event{}, fmt.Errorf("encode %s event: %w", eventType, err)
+	}
+	id := make([]byte, 16)
+	rand.Read(id)
+	return Event{ID: hex.EncodeToString(id), Type: eventType, CreatedAt: time.Now().UTC(), Data: encoded}, nil
+}
+
+// Sign returns the value of HeaderSignature for a body sent at timestamp.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Config of a Dispatcher. Zero values are replaced with the defaults noted.
+type Config struct {
+	URL         string
+	Secret      string
+	MaxAttempts int           // 5
+	Backoff     time.Duration // 1s, the delay before the first retry, doubled after each attempt
+	MaxBackoff  time.Duration // 1m
+	Timeout     time.Duration // 10s per attempt
+	QueueSize   int           // 100
+}
+
+// Dispatcher delivers events to one URL in the background, in the order they
+// were dispatched. An event that still fails after MaxAttempts, or that the
+// receiver rejects with a 4xx status, is saved to the dead-letter store.
+type Dispatcher struct {
+	config      Config
+	client      *http.Client
+	deadLetters DeadLetterStore
+	logger      *slog.Logger
+	queue       chan Event
+}
+
+func New(logger *slog.Logger, config Config, deadLetters DeadLetterStore) *Dispatcher {
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = 5
+	}
+	if config.Backoff <= 0 {
+		config.Backoff = time.Second
+	}
+	if config.MaxBackoff <= 0 {
+		config.MaxBackoff = time.Minute
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 10 * time.Second
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = 100
+	}
+	return &Dispatcher{
+		logger:      logger,
+		config:      config,
+		client:      &http.Client{Timeout: config.Timeout},
+		deadLetters: deadLetters,
+		queue:       make(chan Event, config.QueueSize),
+	}
+}
+
+// Dispatch queues an event without waiting for the delivery. When the queue
+// is full the event goes straight to the dead-letter store.
+func (d *Dispatcher) Dispatch(event Event) {
+	select {
+	case d.queue <- event:
+	default:
+		d.bury(context.Background(), event, 0, errors.New("queue is full"))
+	}
+}
+
+// Run delivers queued events until ctx is done.
+func (d *Dispatcher) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-d.queue:
+			attempts, err := d.deliver(ctx, event)
+			if err != nil {
+				d.bury(ctx, event, attempts, err)
+				continue
+			}
+			metrics.Add("delivered", 1)
+			d.logger.Debug("webhook delivered", "event", event.ID, "type", event.Type, "attempts", attempts)
+		}
+	}
+}
+
+// permanentError is a rejection that retrying will not fix.
+type permanentError struct {
+	status int
+}
+
+func (e permanentError) Error() string {
+	return fmt.Sprintf("receiver rejected the event with status %d", e.status)
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, event Event) (int, error) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return 0, fmt.Errorf("encode event: %w", err)
+	}
+	delay := d.config.Backoff
+	for attempt := 1; ; attempt++ {
+		err = d.post(ctx, event, body)
+		if err == nil || errors.As(err, new(permanentError)) || attempt == d.config.MaxAttempts {
+			return attempt, err
+		}
+		metrics.Add("retried", 1)
+		d.logger.Warn("webhook delivery failed", "event", event.ID, "attempt", attempt, "retry_in", delay, "error", err)
+		select {
+		case <-ctx.Done():
+			return attempt, ctx.Err()
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, d.config.MaxBackoff)
+	}
+}
+
+func (d *Dispatcher) post(ctx context.Context, event Event, body []byte) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, d.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(HeaderEvent, event.Type)
+	request.Header.Set(HeaderID, event.ID)
+	request.Header.Set(HeaderTimestamp, timestamp)
+	request.Header.Set(HeaderSignature, Sign(d.config.Secret, timestamp, body))
+
+	response, err := d.client.Do(request)
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, io.LimitReader(response.Body, 1<<16))
+	response.Body.Close()
+	switch status := response.StatusCode; {
+	case status >= 200 && status <= 299:
+		return nil
+	case status >= 400 && status <= 499 && status != http.StatusRequestTimeout && status != http.StatusTooManyRequests:
+		return permanentError{status: status}
+	default:
+		return fmt.Errorf("receiver answered with status %d", status)
+	}
+}
+
+func (d *Dispatcher) bury(ctx context.Context, event Event, attempts int, err error) {
+	metrics.Add("dead_lettered", 1)
+	d.logger.Error("webhook moved to dead letters", "event", event.ID, "type", event.Type, "attempts", attempts, "error", err)
+	letter := DeadLetter{Event: event, Attempts: attempts, Error: err.Error(), FailedAt: time.Now().UTC()}
+	if saveErr := d.deadLetters.Save(context.WithoutCancel(ctx), letter); saveErr != nil {
+		d.logger.Error("save dead letter", "event", event.ID, "error", saveErr)
+	}
+}
@@ -0,0 +1,132 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+type receiver struct {
+	mu       sync.Mutex
+	statuses []int
+	events   []Event
+	received chan struct{}
+}
+
+// newReceiver answers the deliveries with statuses in turn and then with 200.
+func newReceiver(t *testing.T, secret string, statuses ...int) (*receiver, *httptest.Server) {
+	r := &receiver{statuses: statuses, received: make(chan struct{}, 100)}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		if got, want := req.Header.Get(HeaderSignature), Sign(secret, req.Header.Get(HeaderTimestamp), body); got != want {
+			t.Errorf("signature = %q, want %q", got, want)
+		}
+		r.mu.Lock()
+		status := http.StatusOK
+		if len(r.statuses) > 0 {
+			status, r.statuses = r.statuses[0], r.statuses[1:]
+		}
+		var event Event
+		json.Unmarshal(body, &event)
+		if req.Header.Get(HeaderEvent) != event.Type || req.Header.Get(HeaderID) != event.ID {
+			t.Errorf("headers = %v, event = %#v", req.Header, event)
+		}
+		r.events = append(r.events, event)
+		r.mu.Unlock()
+		w.WriteHeader(status)
+		r.received <- struct{}{}
+	}))
+	t.Cleanup(server.Close)
+	return r, server
+}
+
+func (r *receiver) wait(t *testing.T, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		select {
+		case <-r.received:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("received %d of %d deliveries", i, n)
+		}
+	}
+}
+
+func newTestDispatcher(t *testing.T, url string) (*Dispatcher, *DeadLetters) {
+	t.Helper()
+	deadLetters, err := OpenDeadLetters(filepath.Join(t.TempDir(), "webhook.db"))
+	if err != nil {
+		t.Fatalf("OpenDeadLetters() error = %v", err)
+	}
+	t.Cleanup(func() { _ = deadLetters.Close() })
+	dispatcher := New(slog.Default(), Config{URL: url, Secret: "secret", MaxAttempts: 3, Backoff: time.Millisecond}, deadLetters)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go dispatcher.Run(ctx)
+	return dispatcher, deadLetters
+}
+
+func waitForDeadLetters(t *testing.T, deadLetters *DeadLetters, n int) []DeadLetter {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		letters, err := deadLetters.List(context.Background(), 10)
+		if err != nil {
+			t.Fatalf("List() error = %v", err)
+		}
+		if len(letters) >= n {
+			return letters
+		}
+	}
+	t.Fatalf("dead letters did not reach %d", n)
+	return nil
+}
+
+func TestDispatcherRetriesUntilDelivered(t *testing.T) {
+	receiver, server := newReceiver(t, "secret", http.StatusInternalServerError, http.StatusTooManyRequests)
+	dispatcher, deadLetters := newTestDispatcher(t, server.URL)
+
+	event, err := NewEvent(EventPriceDrop, map[string]int{"price": 100})
+	if err != nil {
+		t.Fatalf("NewEvent() error = %v", err)
+	}
+	dispatcher.Dispatch(event)
+	receiver.wait(t, 3)
+
+	receiver.mu.Lock()
+	defer receiver.mu.Unlock()
+	for _, got := range receiver.events {
+		if got.ID != event.ID || string(got.Data) != `{"price":100}` {
+			t.Fatalf("delivered event = %#v, want %#v", got, event)
+		}
+	}
+	if letters, _ := deadLetters.List(context.Background(), 10); len(letters) != 0 {
+		t.Fatalf("dead letters = %#v", letters)
+	}
+}
+
+func TestDispatcherMovesFailedEventsToDeadLetters(t *testing.T) {
+	receiver, server := newReceiver(t, "secret",
+		http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway,
+		http.StatusBadRequest)
+	dispatcher, deadLetters := newTestDispatcher(t, server.URL)
+
+	retried, _ := NewEvent(EventOutOfStock, nil)
+	rejected, _ := NewEvent(EventParserBroken, nil)
+	dispatcher.Dispatch(retried)
+	dispatcher.Dispatch(rejected)
+	receiver.wait(t, 4)
+
+	letters := waitForDeadLetters(t, deadLetters, 2)
+	if letters[1].Event.ID != retried.ID || letters[1].Attempts != 3 {
+		t.Fatalf("retried dead letter = %#v", letters[1])
+	}
+	if letters[0].Event.ID != rejected.ID || letters[0].Attempts != 1 {
+		t.Fatalf("rejected dead letter = %#v, want no retries after 400", letters[0])
+	}
+}
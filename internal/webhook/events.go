@@ -0,0 +1,80 @@
+package webhook
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"agregator/internal/search"
+	"agregator/internal/watch"
+)
+
+// Notify sends a watch alert as a price_drop or out_of_stock event. It only
+// queues the event, so delivery failures end up in the dead letters rather
+// than being reported to the scheduler.
+func (d *Dispatcher) Notify(_ context.Context, alert watch.Alert) error {
+	eventType := EventPriceDrop
+	if alert.Reason == watch.ReasonOutOfStock {
+		eventType = EventOutOfStock
+	}
+	event, err := NewEvent(eventType, alert)
+	if err != nil {
+		return err
+	}
+	d.Dispatch(event)
+	return nil
+}
+
+// ParserBroken is the data of a parser_broken event.
+type ParserBroken struct {
+	Marketplace string    `json:"marketplace"`
+	Query       string    `json:"query"`
+	Error       string    `json:"error"`
+	DetectedAt  time.Time `json:"detected_at"`
+}
+
+// ParserMonitor sends a parser_broken event when a marketplace answers with
+// data the adapter cannot parse, at most once per cooldown for each
+// marketplace.
+type ParserMonitor struct {
+	dispatcher *Dispatcher
+	cooldown   time.Duration
+	now        func() time.Time
+
+	mu   sync.Mutex
+	last map[string]time.Time
+}
+
+func NewParserMonitor(dispatcher *Dispatcher, cooldown time.Duration) *ParserMonitor {
+	return &ParserMonitor{dispatcher: dispatcher, cooldown: cooldown, now: time.Now, last: make(map[string]time.Time)}
+}
+
+func (m *ParserMonitor) Fetched(_ context.Context, query string, sources []search.SourceStatus) {
+	for _, source := range sources {
+		if source.Error != search.CodeBadResponse || !m.due(source.Marketplace) {
+			continue
+		}
+		event, err := NewEvent(EventParserBroken, ParserBroken{
+			Marketplace: source.Marketplace,
+			Query:       query,
+			Error:       source.Error,
+			DetectedAt:  m.now().UTC(),
+		})
+		if err != nil {
+			m.dispatcher.logger.Error("create parser_broken event", "error", err)
+			continue
+		}
+		m.dispatcher.Dispatch(event)
+	}
+}
+
+func (m *ParserMonitor) due(marketplace string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	if last, ok := m.last[marketplace]; ok && now.Sub(last) < m.cooldown {
+		return false
+	}
+	m.last[marketplace] = now
+	return true
+}
@@ -0,0 +1,81 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"testing"
+	"time"
+
+	"agregator/internal/product"
+	"agregator/internal/search"
+	"agregator/internal/watch"
+)
+
+type brokenMarketplace struct{}
+
+func (brokenMarketplace) Name() string {
+	return "ozon"
+}
+
+func (brokenMarketplace) Search(context.Context, string) ([]product.Product, error) {
+	return nil, fmt.Errorf("%w: unexpected JSON", search.ErrBadResponse)
+}
+
+type okMarketplace struct{}
+
+func (okMarketplace) Name() string {
+	return "wb"
+}
+
+func (okMarketplace) Search(context.Context, string) ([]product.Product, error) {
+	return []product.Product{{Marketplace: "wb", ProductID: "1", DiscountPriceKopecks: 100}}, nil
+}
+
+func TestParserMonitorReportsBrokenMarketplaceOnce(t *testing.T) {
+	receiver, server := newReceiver(t, "secret")
+	dispatcher, _ := newTestDispatcher(t, server.URL)
+	service := search.New(slog.Default(), nil, brokenMarketplace{}, okMarketplace{})
+	service.SetFetchObserver(NewParserMonitor(dispatcher, time.Hour))
+
+	for _, query := range []string{"phone", "tv"} {
+		if _, err := service.Search(context.Background(), query, search.Options{}); err != nil {
+			t.Fatalf("Search() error = %v", err)
+		}
+	}
+	receiver.wait(t, 1)
+	select {
+	case <-receiver.received:
+		t.Fatal("parser_broken sent twice within the cooldown")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	receiver.mu.Lock()
+	defer receiver.mu.Unlock()
+	var data ParserBroken
+	if err := json.Unmarshal(receiver.events[0].Data, &data); err != nil {
+		t.Fatalf("decode event data: %v", err)
+	}
+	if receiver.events[0].Type != EventParserBroken || data.Marketplace != "ozon" || data.Query != "phone" || data.Error != search.CodeBadResponse {
+		t.Fatalf("event = %#v, data = %#v", receiver.events[0], data)
+	}
+}
+
+func TestNotifySendsWatchAlerts(t *testing.T) {
+	receiver, server := newReceiver(t, "secret")
+	dispatcher, _ := newTestDispatcher(t, server.URL)
+
+	for _, reason := range []string{watch.ReasonTarget, watch.ReasonOutOfStock} {
+		if err := dispatcher.Notify(context.Background(), watch.Alert{Reason: reason}); err != nil {
+			t.Fatalf("Notify() error = %v", err)
+		}
+	}
+	receiver.wait(t, 2)
+
+	receiver.mu.Lock()
+	defer receiver.mu.Unlock()
+	if receiver.events[0].Type != EventPriceDrop || receiver.events[1].Type != EventOutOfStock {
+		t.Fatalf("event types = %q, %q", receiver.events[0].Type, receiver.events[1].Type)
+	}
+}
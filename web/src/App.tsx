@@ -1,7 +1,11 @@
-import React, { useState } from 'react'
+import React, { useEffect, useRef, useState } from 'react'
 import ProductCard from './components/ProductCard'
 
+const PAGE_SIZE = 30
+
 type Product = {
+  marketplace: string
+  product_key: string
   product_url: string
   image_url: string
   product_id: string
@@ -11,6 +15,45 @@ type Product = {
   product_statistic: string
   product_stars: string
   product_reviews: string
+  price_check?: PriceCheck
+}
+
+type PriceCheck = {
+  verdict: 'unknown' | 'real' | 'regular' | 'fake'
+  median_price?: number
+  observations: number
+  below_median: boolean
+  base_price_charged: boolean
+}
+
+type Batch = {
+  marketplace?: string
+  products: Product[]
+  cached: boolean
+}
+
+type SourceStatus = {
+  marketplace: string
+  status: 'ok' | 'error' | 'timeout'
+  count: number
+}
+
+type Marketplace = {
+  name: string
+  label: string
+}
+
+type Summary = {
+  total: number
+  cached: boolean
+  sources: SourceStatus[]
+}
+
+const statusText: Record<string, string> = {
+  loading: 'загрузка…',
+  ok: 'готово',
+  error: 'ошибка',
+  timeout: 'таймаут',
 }
 
 export default function App() {
@@ -18,6 +61,11 @@ export default function App() {
   const [loading, setLoading] = useState(false)
   const [error, setError] = useState<string | null>(null)
   const [items, setItems] = useState<Product[]>([])
+  const [visible, setVisible] = useState(PAGE_SIZE)
+  const [sources, setSources] = useState<Record<string, string>>({})
+  const [marketplaces, setMarketplaces] = useState<Marketplace[]>([])
+  const stream = useRef<EventSource | null>(null)
+  const sentinel = useRef<HTMLDivElement | null>(null)
 
   function formatPrice(kopecks: number) {
     return new Intl.NumberFormat('ru-RU', {
@@ -53,25 +101,62 @@ export default function App() {
     })
   }
 
-  async function search() {
-    if (!q.trim()) return
+  function search() {
+    const query = q.trim()
+    if (!query) return
+    stream.current?.close()
     setLoading(true)
     setError(null)
     setItems([])
-    try {
-      const r = await fetch(`/search?query=${encodeURIComponent(q.trim())}`)
-      if (!r.ok) throw new Error(`HTTP ${r.status}`)
-      const data: Product[] = await r.json()
-      const filtered = data.filter(p => matchesQuery(p.product_name, q))
-      const sorted = [...filtered].sort((a, b) => a.product_discount_price - b.product_discount_price)
-      setItems(sorted)
-    } catch (e: any) {
-      setError(e.message || 'Ошибка')
-    } finally {
+    setVisible(PAGE_SIZE)
+    setSources(Object.fromEntries(marketplaces.map(m => [m.name, 'loading'])))
+
+    const es = new EventSource(`/search/stream?${new URLSearchParams({ query })}`)
+    stream.current = es
+    es.addEventListener('batch', e => {
+      const batch: Batch = JSON.parse((e as MessageEvent).data)
+      const found = batch.products.filter(p => matchesQuery(p.product_name, query))
+      setItems(prev => [...prev, ...found].sort((a, b) => a.product_discount_price - b.product_discount_price))
+      if (batch.cached) setSources({})
+    })
+    es.addEventListener('status', e => {
+      const status: SourceStatus = JSON.parse((e as MessageEvent).data)
+      setSources(prev => ({ ...prev, [status.marketplace]: status.status }))
+    })
+    es.addEventListener('summary', e => {
+      const summary: Summary = JSON.parse((e as MessageEvent).data)
+      es.close()
+      setLoading(false)
+      if (summary.sources.length && summary.sources.every(s => s.status !== 'ok')) {
+        setError('магазины недоступны, попробуйте позже')
+      }
+    })
+    es.onerror = () => {
+      es.close()
       setLoading(false)
+      setError('поиск прерван')
     }
   }
 
+  useEffect(() => () => stream.current?.close(), [])
+
+  useEffect(() => {
+    fetch('/marketplaces')
+      .then(res => (res.ok ? res.json() : { marketplaces: [] }))
+      .then((data: { marketplaces: Marketplace[] }) => setMarketplaces(data.marketplaces))
+      .catch(() => {})
+  }, [])
+
+  useEffect(() => {
+    const el = sentinel.current
+    if (!el || visible >= items.length) return
+    const observer = new IntersectionObserver(entries => {
+      if (entries.some(e => e.isIntersecting)) setVisible(v => v + PAGE_SIZE)
+    }, { rootMargin: '400px' })
+    observer.observe(el)
+    return () => observer.disconnect()
+  }, [visible, items.length])
+
   function onSubmit(e: React.FormEvent) {
     e.preventDefault()
     search()
@@ -82,19 +167,20 @@ export default function App() {
     items[0]
   ) : null
 
-  function shopName(url: string) {
+  function marketplaceLabel(name: string) {
+    return marketplaces.find(m => m.name === name)?.label || name
+  }
+
+  function shopName(p: Product) {
+    if (p.marketplace) return marketplaceLabel(p.marketplace)
     try {
-      const u = new URL(url)
-      const h = u.hostname
-      if (h.includes('ozon')) return 'Ozon'
-      if (h.includes('wildberries')) return 'Wildberries'
-      return h.replace('www.', '')
+      return new URL(p.product_url).hostname.replace('www.', '')
     } catch {
       return ''
     }
   }
 
-  const bestPriceText = bestItem ? `${formatPrice(bestItem.product_discount_price)} — ${shopName(bestItem.product_url)}` : ''
+  const bestPriceText = bestItem ? `${formatPrice(bestItem.product_discount_price)} — ${shopName(bestItem)}` : ''
 
   return (
     <div className="app">
@@ -104,8 +190,7 @@ export default function App() {
             <h1>Агрегатор цен</h1>
             <p>Сравниваем цены из нескольких магазинов. Введите запрос — покажем лучшие предложения.</p>
             <div className="badges">
-              <span className="badge">Ozon</span>
-              <span className="badge">Wildberries</span>
+              {marketplaces.map(m => <span key={m.name} className="badge">{m.label}</span>)}
             </div>
           </div>
           <form className="search-bar" onSubmit={onSubmit}>
@@ -113,15 +198,23 @@ export default function App() {
             <button type="submit">Сравнить</button>
           </form>
           <div className="meta">{items.length ? `Найдено: ${items.length} • Лучшая цена: ${bestPriceText}` : 'Введите запрос, например «iphone 15»'}</div>
+          {Object.keys(sources).length ? (
+            <div className="badges sources">
+              {Object.entries(sources).map(([name, status]) => (
+                <span key={name} className={`badge status-${status}`}>{marketplaceLabel(name)}: {statusText[status] || status}</span>
+              ))}
+            </div>
+          ) : null}
         </div>
       </header>
       <main className="container">
-        {loading && <div className="state loading">Загрузка…</div>}
+        {loading && items.length === 0 && <div className="state loading">Загрузка…</div>}
         {error && <div className="state error">Ошибка: {error}</div>}
         {!loading && !error && items.length === 0 && q && <div className="state empty">Ничего не найдено</div>}
         <div className="grid" style={{ display: items.length ? 'grid' : 'none' }}>
-          {items.map((p, i) => <ProductCard key={p.product_id || i.toString()} product={p} />)}
+          {items.slice(0, visible).map((p, i) => <ProductCard key={p.product_key || p.product_id || i.toString()} product={p} shopLabel={marketplaceLabel(p.marketplace)} />)}
         </div>
+        {visible < items.length && <div ref={sentinel} className="state loading" />}
       </main>
     </div>
   )
@@ -1,6 +1,8 @@
 import React from 'react'
 
 type Product = {
+  marketplace: string
+  product_key: string
   product_url: string
   image_url: string
   product_id: string
@@ -10,9 +12,18 @@ type Product = {
   product_statistic: string
   product_stars: string
   product_reviews: string
+  price_check?: PriceCheck
 }
 
-type Props = { product: Product }
+type PriceCheck = {
+  verdict: 'unknown' | 'real' | 'regular' | 'fake'
+  median_price?: number
+  observations: number
+  below_median: boolean
+  base_price_charged: boolean
+}
+
+type Props = { product: Product; shopLabel?: string }
 
 function parseStars(s: string) {
   const v = s.replace(',', '.').trim()
@@ -39,7 +50,18 @@ function formatPrice(kopecks: number) {
   }).format(kopecks / 100)
 }
 
-export default function ProductCard({ product }: Props) {
+const verdictLabels: Record<string, string> = {
+  real: 'Цена ниже обычной',
+  fake: 'Скидка завышена',
+}
+
+function verdictTitle(check: PriceCheck) {
+  const median = formatPrice(check.median_price || 0)
+  const base = check.base_price_charged ? '' : ' Старая цена за это время не встречалась.'
+  return `Обычная цена за 30 дней: ${median}.${base}`
+}
+
+export default function ProductCard({ product, shopLabel }: Props) {
   const link = product.product_url
   const img = product.image_url
   const name = product.product_name
@@ -48,6 +70,9 @@ export default function ProductCard({ product }: Props) {
   const starsVal = parseStars(product.product_stars)
   const reviewsText = product.product_reviews
   const statistic = product.product_statistic
+  const shop = shopLabel || product.marketplace
+  const check = product.price_check
+  const verdict = check ? verdictLabels[check.verdict] : undefined
 
   return (
     <div className="card">
@@ -55,11 +80,13 @@ export default function ProductCard({ product }: Props) {
         {img ? <img src={img} alt={name} onError={(e) => { (e.currentTarget as HTMLImageElement).style.display = 'none' }} /> : null}
       </div>
       <div className="content">
+        {shop ? <span className={`badge shop shop-${product.marketplace}`}>{shop}</span> : null}
         <div className="title" title={name}>{name || 'Товар'}</div>
         <div className="price-row">
           {priceNow ? <div className="price-now">{priceNow}</div> : null}
           {priceOld ? <div className="price-old">{priceOld}</div> : null}
         </div>
+        {check && verdict ? <span className={`badge deal deal-${check.verdict}`} title={verdictTitle(check)}>{verdict}</span> : null}
         <div className="stats">
           {starsVal != null ? <span className="stars" title={product.product_stars}>{renderStars(starsVal)}</span> : null}
           {reviewsText ? <span>{reviewsText} отзывов</span> : null}